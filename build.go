@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultBuildTimeout 构建命令的默认超时时间
+const defaultBuildTimeout = 5 * time.Minute
+
+// buildDiagnosticsMax 返回的诊断信息条数上限
+const buildDiagnosticsMax = 50
+
+// BuildSpec 启动前执行的构建命令（start_process 的 build_command / build_args 参数）
+type BuildSpec struct {
+	Command string
+	Args    []string
+	Timeout time.Duration
+}
+
+// Diagnostic 从构建输出中解析出的一条编译错误
+type Diagnostic struct {
+	File    string
+	Line    int
+	Column  int // 0 表示输出中没有列号
+	Message string
+}
+
+// BuildResult 构建命令的执行结果
+type BuildResult struct {
+	Command     string
+	Dir         string
+	Duration    time.Duration
+	ExitCode    int
+	Err         error // 启动失败、超时等非退出码错误
+	Output      string
+	Diagnostics []Diagnostic
+}
+
+var (
+	// Go / gcc / clang / rustc 等：file:line:col: message 或 file:line: message
+	diagnosticPattern = regexp.MustCompile(`^\s*(?:-->\s*)?((?:[A-Za-z]:)?[^\s:][^:]*?\.\w+):(\d+)(?::(\d+))?:?\s*(.*)$`)
+	// TypeScript / MSBuild 等：file(line,col): message
+	diagnosticParenPattern = regexp.MustCompile(`^\s*([^\s(][^(]*?\.\w+)\((\d+)(?:,(\d+))?\):\s*(.*)$`)
+)
+
+// Success 构建是否成功
+func (r *BuildResult) Success() bool {
+	return r.Err == nil && r.ExitCode == 0
+}
+
+// runBuild 在进程的工作目录中执行构建命令，使用与进程相同的环境变量
+func runBuild(spec LaunchSpec) *BuildResult {
+	logger := GetLogger()
+	build := spec.Build
+
+	timeout := build.Timeout
+	if timeout <= 0 {
+		timeout = defaultBuildTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, build.Command, build.Args...)
+	cmd.Dir = resolveWorkDir(spec)
+	setProcessGroupID(cmd)
+	// 超时终止后，后代进程仍持有输出管道时最多再等待 5 秒
+	cmd.WaitDelay = 5 * time.Second
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	result := &BuildResult{
+		Command: strings.Join(cmd.Args, " "),
+		Dir:     cmd.Dir,
+	}
+	env, _, err := launchEnv(spec)
+	if err != nil {
+		result.Err = err
+		result.ExitCode = -1
+		return result
+	}
+	cmd.Env = mergeEnv(spec, env)
+	logger.Info("进程 %s 执行构建: %s (目录: %s)", spec.Name, result.Command, result.Dir)
+
+	start := time.Now()
+	err = cmd.Run()
+	result.Duration = time.Since(start)
+	result.Output = strings.TrimRight(output.String(), "\n")
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case ctx.Err() == context.DeadlineExceeded:
+		result.Err = fmt.Errorf("构建超时（%v）", timeout)
+		result.ExitCode = -1
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		result.Err = err
+		result.ExitCode = -1
+	}
+
+	if !result.Success() {
+		result.Diagnostics = parseDiagnostics(result.Output)
+		logger.Error("进程 %s 构建失败: 退出码 %d, %d 条诊断信息", spec.Name, result.ExitCode, len(result.Diagnostics))
+	} else {
+		logger.Info("进程 %s 构建成功，耗时 %v", spec.Name, result.Duration)
+	}
+	return result
+}
+
+// parseDiagnostics 从构建输出中解析编译错误，缩进的续行（如 Go 的 have/want）合并到上一条
+func parseDiagnostics(output string) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if diagnostic, ok := parseDiagnosticLine(line); ok {
+			diagnostics = append(diagnostics, diagnostic)
+			continue
+		}
+		if n := len(diagnostics); n > 0 && (strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "    ")) {
+			diagnostics[n-1].Message += "\n" + strings.TrimSpace(line)
+		}
+	}
+	if len(diagnostics) > buildDiagnosticsMax {
+		diagnostics = diagnostics[:buildDiagnosticsMax]
+	}
+	return diagnostics
+}
+
+// parseDiagnosticLine 解析单行编译错误
+func parseDiagnosticLine(line string) (Diagnostic, bool) {
+	match := diagnosticPattern.FindStringSubmatch(line)
+	if match == nil {
+		match = diagnosticParenPattern.FindStringSubmatch(line)
+	}
+	if match == nil {
+		return Diagnostic{}, false
+	}
+	lineNo, _ := strconv.Atoi(match[2])
+	column, _ := strconv.Atoi(match[3])
+	return Diagnostic{
+		File:    strings.TrimPrefix(match[1], "./"),
+		Line:    lineNo,
+		Column:  column,
+		Message: strings.TrimSpace(match[4]),
+	}, true
+}
+
+// Location 诊断位置，如 main.go:12:5
+func (d Diagnostic) Location() string {
+	if d.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d", d.File, d.Line, d.Column)
+	}
+	return fmt.Sprintf("%s:%d", d.File, d.Line)
+}
+
+// Report 构建失败的文字报告
+func (r *BuildResult) Report() string {
+	var builder strings.Builder
+	builder.WriteString("构建失败，进程未启动\n")
+	builder.WriteString(fmt.Sprintf("构建命令: %s\n", r.Command))
+	builder.WriteString(fmt.Sprintf("工作目录: %s\n", r.Dir))
+	if r.Err != nil {
+		builder.WriteString(fmt.Sprintf("错误: %v\n", r.Err))
+	} else {
+		builder.WriteString(fmt.Sprintf("退出码: %d\n", r.ExitCode))
+	}
+
+	if len(r.Diagnostics) > 0 {
+		builder.WriteString(fmt.Sprintf("\n编译错误（%d 条）:\n", len(r.Diagnostics)))
+		for _, d := range r.Diagnostics {
+			builder.WriteString(fmt.Sprintf("- %s: %s\n", d.Location(), strings.ReplaceAll(d.Message, "\n", "\n  ")))
+		}
+	}
+	builder.WriteString("\n构建输出:\n")
+	builder.WriteString(r.Output)
+	builder.WriteString("\n")
+	return builder.String()
+}
+
+// structured 构建结果的结构化形式
+func (r *BuildResult) structured() map[string]any {
+	diagnostics := make([]map[string]any, 0, len(r.Diagnostics))
+	for _, d := range r.Diagnostics {
+		diagnostics = append(diagnostics, map[string]any{
+			"file":    d.File,
+			"line":    d.Line,
+			"column":  d.Column,
+			"message": d.Message,
+		})
+	}
+	item := map[string]any{
+		"build_failed": !r.Success(),
+		"command":      r.Command,
+		"dir":          r.Dir,
+		"exit_code":    r.ExitCode,
+		"duration_ms":  r.Duration.Milliseconds(),
+		"diagnostics":  diagnostics,
+		"output":       r.Output,
+	}
+	if r.Err != nil {
+		item["error"] = r.Err.Error()
+	}
+	return item
+}
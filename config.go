@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// projectConfigFile 项目配置文件名，放在工作目录下，定义可以只按名称启动的服务
+const projectConfigFile = ".gomcp.json"
+
+// ProjectConfig 项目配置文件
+//
+//	{
+//	  "services": {
+//	    "backend": {
+//	      "command": "go",
+//	      "args": ["run", "."],
+//	      "env": {"QB_PROFILE": "bin2"},
+//	      "health_check_url": "http://localhost:27028/healthz",
+//	      "timeout_seconds": 120
+//	    }
+//	  }
+//	}
+type ProjectConfig struct {
+	Path     string                   `json:"-"` // 配置文件的绝对路径
+	Services map[string]ServiceConfig `json:"services"`
+}
+
+// ServiceConfig 配置文件中的一个服务，字段含义与 start_process 的同名参数相同
+type ServiceConfig struct {
+	Description       string            `json:"description,omitempty"`
+	Command           string            `json:"command"`
+	Args              []string          `json:"args,omitempty"`
+	WorkDir           string            `json:"work_dir,omitempty"` // 相对路径基于配置文件所在目录，默认为该目录
+	Env               map[string]string `json:"env,omitempty"`
+	EnvFiles          []string          `json:"env_files,omitempty"` // 相对路径基于服务的工作目录
+	InheritEnv        string            `json:"inherit_env,omitempty"`
+	InheritEnvAllow   []string          `json:"inherit_env_allow,omitempty"`
+	UnsetEnv          []string          `json:"unset_env,omitempty"`
+	HealthCheckURL    string            `json:"health_check_url,omitempty"`
+	Readiness         *ReadinessSpec    `json:"readiness,omitempty"`
+	Liveness          *LivenessSpec     `json:"liveness,omitempty"`
+	HealthCheckMethod string            `json:"health_check_method,omitempty"`
+	TimeoutSeconds    int               `json:"timeout_seconds,omitempty"`
+	StopGraceSeconds  int               `json:"stop_grace_seconds,omitempty"`
+}
+
+// configDir 查找配置文件的目录：指定的工作目录（相对路径基于当前目录），未指定时为当前目录
+func configDir(workDir string) string {
+	cwd, _ := os.Getwd()
+	if workDir == "" {
+		return cwd
+	}
+	if !filepath.IsAbs(workDir) {
+		workDir = filepath.Join(cwd, workDir)
+	}
+	return filepath.Clean(workDir)
+}
+
+// loadProjectConfig 加载目录下的项目配置文件，文件不存在时返回 nil
+// 配置中的错误（JSON 语法、未知字段、服务参数不合法）全部列出，便于一次修正
+func loadProjectConfig(dir string) (*ProjectConfig, error) {
+	path := filepath.Join(dir, projectConfigFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取项目配置 %s 失败: %w", path, err)
+	}
+
+	config := &ProjectConfig{Path: path}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("项目配置 %s 解析失败: %s", path, describeJSONError(data, err))
+	}
+
+	var problems []string
+	for _, name := range config.ServiceNames() {
+		for _, problem := range config.Services[name].validate() {
+			problems = append(problems, fmt.Sprintf("- 服务 '%s': %s", name, problem))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("项目配置 %s 无效:\n%s", path, strings.Join(problems, "\n"))
+	}
+	return config, nil
+}
+
+// describeJSONError 为 JSON 解析错误补充行列号
+func describeJSONError(data []byte, err error) string {
+	var offset int64 = -1
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	}
+	if offset < 0 || offset > int64(len(data)) {
+		return err.Error()
+	}
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	column := int(offset) - bytes.LastIndexByte(data[:offset], '\n')
+	return fmt.Sprintf("第 %d 行第 %d 列: %v", line, column, err)
+}
+
+// validate 检查服务配置，返回所有问题
+func (s ServiceConfig) validate() []string {
+	var problems []string
+	switch {
+	case s.Command == "":
+		problems = append(problems, "command 不能为空")
+	case strings.Contains(s.Command, " "):
+		problems = append(problems, fmt.Sprintf("command '%s' 包含空格，请将可执行文件名放在 command 中，参数放在 args 中", s.Command))
+	}
+	if s.HealthCheckURL != "" {
+		if u, err := url.Parse(s.HealthCheckURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("health_check_url '%s' 不是合法的 http/https 地址", s.HealthCheckURL))
+		}
+	}
+	if _, err := newReadinessProbe(LaunchSpec{HealthCheckURL: s.HealthCheckURL, Readiness: s.Readiness}); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if s.Liveness != nil {
+		if _, err := newLivenessProbe(LaunchSpec{HealthCheckURL: s.HealthCheckURL, Liveness: s.Liveness}); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if _, err := parseInheritEnv(s.InheritEnv, s.InheritEnvAllow); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if s.TimeoutSeconds < 0 {
+		problems = append(problems, "timeout_seconds 不能为负数")
+	}
+	if s.StopGraceSeconds < 0 {
+		problems = append(problems, "stop_grace_seconds 不能为负数")
+	}
+	return problems
+}
+
+// applyTo 用服务配置补充调用方未传入的启动参数，env 按变量合并（同名以传入的为准）
+// dir 为配置文件所在目录：work_dir 为空或只是指向该目录（用于查找配置）时，使用服务的工作目录
+func (s ServiceConfig) applyTo(args *launchArgs, dir string) {
+	if args.Command == "" {
+		args.Command = s.Command
+	}
+	if len(args.Args) == 0 {
+		args.Args = s.Args
+	}
+	if args.WorkDir == "" || configDir(args.WorkDir) == dir {
+		args.WorkDir = s.WorkDir
+	}
+	if len(s.Env) > 0 {
+		env := make(map[string]string, len(s.Env)+len(args.Env))
+		for key, value := range s.Env {
+			env[key] = value
+		}
+		for key, value := range args.Env {
+			env[key] = value
+		}
+		args.Env = env
+	}
+	if len(args.EnvFiles) == 0 {
+		args.EnvFiles = s.EnvFiles
+	}
+	if args.InheritEnv == "" && len(args.InheritEnvAllow) == 0 {
+		args.InheritEnv = s.InheritEnv
+		args.InheritEnvAllow = s.InheritEnvAllow
+	}
+	if len(args.UnsetEnv) == 0 {
+		args.UnsetEnv = s.UnsetEnv
+	}
+	if args.HealthCheckURL == "" {
+		args.HealthCheckURL = s.HealthCheckURL
+	}
+	if args.Readiness == nil {
+		args.Readiness = s.Readiness
+	}
+	if args.Liveness == nil {
+		args.Liveness = s.Liveness
+	}
+	if args.HealthCheckMethod == "" {
+		args.HealthCheckMethod = s.HealthCheckMethod
+	}
+	if args.TimeoutSeconds == 0 {
+		args.TimeoutSeconds = s.TimeoutSeconds
+	}
+}
+
+// ServiceNames 按名称排序的服务列表
+func (c *ProjectConfig) ServiceNames() []string {
+	names := make([]string, 0, len(c.Services))
+	for name := range c.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Service 获取服务配置，work_dir 解析为绝对路径
+func (c *ProjectConfig) Service(name string) (ServiceConfig, bool) {
+	service, ok := c.Services[name]
+	if !ok {
+		return ServiceConfig{}, false
+	}
+	dir := filepath.Dir(c.Path)
+	switch {
+	case service.WorkDir == "":
+		service.WorkDir = dir
+	case !filepath.IsAbs(service.WorkDir):
+		service.WorkDir = filepath.Join(dir, service.WorkDir)
+	}
+	return service, true
+}
+
+// CommandLine 服务的完整命令行
+func (s ServiceConfig) CommandLine() string {
+	return strings.TrimSpace(s.Command + " " + strings.Join(s.Args, " "))
+}
+
+// findService 在工作目录的项目配置中查找服务，没有配置文件或没有该服务时 ok 为 false
+func findService(name, workDir string) (ServiceConfig, *ProjectConfig, bool, error) {
+	config, err := loadProjectConfig(configDir(workDir))
+	if err != nil || config == nil {
+		return ServiceConfig{}, config, false, err
+	}
+	service, ok := config.Service(name)
+	return service, config, ok, nil
+}
+
+// serviceHint 找不到服务时的提示，列出项目配置中已定义的服务
+func serviceHint(name string, config *ProjectConfig) string {
+	if config == nil {
+		return fmt.Sprintf("\n提示：工作目录下没有 %s，无法按名称 '%s' 启动", projectConfigFile, name)
+	}
+	return fmt.Sprintf("\n提示：%s 中没有服务 '%s'，已定义的服务: %s", config.Path, name, strings.Join(config.ServiceNames(), ", "))
+}
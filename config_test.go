@@ -0,0 +1,238 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeProjectConfig 在临时目录写入 .gomcp.json，返回该目录
+func writeProjectConfig(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, projectConfigFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoadProjectConfig(t *testing.T) {
+	dir := writeProjectConfig(t, `{
+  "services": {
+    "backend": {
+      "command": "go",
+      "args": ["run", "."],
+      "work_dir": "server",
+      "env": {"PORT": "8080"},
+      "health_check_url": "http://localhost:8080/healthz",
+      "timeout_seconds": 120
+    },
+    "worker": {
+      "command": "/usr/bin/worker",
+      "readiness": {"type": "log", "pattern": "ready"}
+    }
+  }
+}`)
+
+	config, err := loadProjectConfig(dir)
+	if err != nil {
+		t.Fatalf("loadProjectConfig: %v", err)
+	}
+	if want := filepath.Join(dir, projectConfigFile); config.Path != want {
+		t.Errorf("Path = %q, want %q", config.Path, want)
+	}
+	if names := config.ServiceNames(); !reflect.DeepEqual(names, []string{"backend", "worker"}) {
+		t.Errorf("ServiceNames() = %q", names)
+	}
+
+	// work_dir 相对配置文件所在目录，未设置时为该目录
+	backend, ok := config.Service("backend")
+	if !ok {
+		t.Fatal("backend not found")
+	}
+	if want := filepath.Join(dir, "server"); backend.WorkDir != want {
+		t.Errorf("backend WorkDir = %q, want %q", backend.WorkDir, want)
+	}
+	if backend.CommandLine() != "go run ." || backend.TimeoutSeconds != 120 || backend.Env["PORT"] != "8080" {
+		t.Errorf("backend = %+v", backend)
+	}
+	worker, _ := config.Service("worker")
+	if worker.WorkDir != dir {
+		t.Errorf("worker WorkDir = %q, want %q", worker.WorkDir, dir)
+	}
+	if _, ok := config.Service("missing"); ok {
+		t.Error("Service(missing) ok = true")
+	}
+}
+
+func TestLoadProjectConfigMissing(t *testing.T) {
+	config, err := loadProjectConfig(t.TempDir())
+	if config != nil || err != nil {
+		t.Errorf("loadProjectConfig() = %v, %v; want nil, nil", config, err)
+	}
+
+	_, config, ok, err := findService("backend", t.TempDir())
+	if ok || config != nil || err != nil {
+		t.Errorf("findService() = %v, %v, %v; want not found", config, ok, err)
+	}
+	if hint := serviceHint("backend", nil); !strings.Contains(hint, projectConfigFile) {
+		t.Errorf("serviceHint() = %q", hint)
+	}
+}
+
+func TestLoadProjectConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		want    []string // 错误信息中应包含的片段
+	}{
+		{
+			name:    "unknown service field",
+			content: `{"services": {"api": {"command": "go", "health_check_url": "http://localhost:1/", "healthcheck": "x"}}}`,
+			want:    []string{`unknown field "healthcheck"`},
+		},
+		{
+			name:    "unknown top-level field",
+			content: `{"service": {}}`,
+			want:    []string{`unknown field "service"`},
+		},
+		{
+			name:    "syntax error with position",
+			content: "{\n  \"services\": {\n    \"api\": {\"command\": \"go\",}\n  }\n}",
+			want:    []string{"第 3 行"},
+		},
+		{
+			name:    "wrong type",
+			content: `{"services": {"api": {"command": "go", "timeout_seconds": "60"}}}`,
+			want:    []string{"第 1 行", "timeout_seconds"},
+		},
+		{
+			name: "all invalid services listed",
+			content: `{"services": {
+				"api": {"command": "go run .", "health_check_url": "localhost:8080"},
+				"web": {"command": "", "health_check_url": "http://localhost:3000/", "timeout_seconds": -1, "inherit_env": "some"}
+			}}`,
+			want: []string{
+				"服务 'api': command 'go run .' 包含空格",
+				"服务 'api': health_check_url 'localhost:8080' 不是合法的 http/https 地址",
+				"服务 'web': command 不能为空",
+				"服务 'web': timeout_seconds 不能为负数",
+				"服务 'web': inherit_env",
+			},
+		},
+		{
+			name:    "no readiness",
+			content: `{"services": {"api": {"command": "go"}}}`,
+			want:    []string{"服务 'api'"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := loadProjectConfig(writeProjectConfig(t, tc.content))
+			if err == nil {
+				t.Fatalf("loadProjectConfig() = %+v, want error", config)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestServiceConfigApplyTo(t *testing.T) {
+	dir := t.TempDir()
+	service := ServiceConfig{
+		Command:          "go",
+		Args:             []string{"run", "."},
+		WorkDir:          filepath.Join(dir, "server"),
+		Env:              map[string]string{"PORT": "8080", "PROFILE": "dev"},
+		EnvFiles:         []string{".env"},
+		InheritEnv:       "allow",
+		InheritEnvAllow:  []string{"PATH"},
+		HealthCheckURL:   "http://localhost:8080/healthz",
+		TimeoutSeconds:   120,
+		StopGraceSeconds: 10,
+	}
+
+	for _, tc := range []struct {
+		name string
+		args launchArgs
+		want launchArgs
+	}{
+		{
+			name: "only name",
+			want: launchArgs{
+				Command:         "go",
+				Args:            []string{"run", "."},
+				WorkDir:         filepath.Join(dir, "server"),
+				Env:             map[string]string{"PORT": "8080", "PROFILE": "dev"},
+				EnvFiles:        []string{".env"},
+				InheritEnv:      "allow",
+				InheritEnvAllow: []string{"PATH"},
+				HealthCheckURL:  "http://localhost:8080/healthz",
+				TimeoutSeconds:  120,
+			},
+		},
+		{
+			name: "explicit args win and env is merged",
+			args: launchArgs{
+				Args:           []string{"run", "./cmd/api"},
+				Env:            map[string]string{"PROFILE": "test", "DEBUG": "1"},
+				InheritEnv:     "full",
+				HealthCheckURL: "http://localhost:9090/ready",
+				TimeoutSeconds: 30,
+			},
+			want: launchArgs{
+				Command:         "go",
+				Args:            []string{"run", "./cmd/api"},
+				WorkDir:         filepath.Join(dir, "server"),
+				Env:             map[string]string{"PORT": "8080", "PROFILE": "test", "DEBUG": "1"},
+				EnvFiles:        []string{".env"},
+				InheritEnv:      "full",
+				InheritEnvAllow: nil,
+				HealthCheckURL:  "http://localhost:9090/ready",
+				TimeoutSeconds:  30,
+			},
+		},
+		{
+			name: "work_dir pointing at the config directory uses the service work_dir",
+			args: launchArgs{WorkDir: dir},
+			want: launchArgs{
+				Command:         "go",
+				Args:            []string{"run", "."},
+				WorkDir:         filepath.Join(dir, "server"),
+				Env:             map[string]string{"PORT": "8080", "PROFILE": "dev"},
+				EnvFiles:        []string{".env"},
+				InheritEnv:      "allow",
+				InheritEnvAllow: []string{"PATH"},
+				HealthCheckURL:  "http://localhost:8080/healthz",
+				TimeoutSeconds:  120,
+			},
+		},
+		{
+			name: "other work_dir is kept",
+			args: launchArgs{WorkDir: filepath.Join(dir, "other"), InheritEnvAllow: []string{"HOME"}},
+			want: launchArgs{
+				Command:         "go",
+				Args:            []string{"run", "."},
+				WorkDir:         filepath.Join(dir, "other"),
+				Env:             map[string]string{"PORT": "8080", "PROFILE": "dev"},
+				EnvFiles:        []string{".env"},
+				InheritEnvAllow: []string{"HOME"},
+				HealthCheckURL:  "http://localhost:8080/healthz",
+				TimeoutSeconds:  120,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			args := tc.args
+			service.applyTo(&args, dir)
+			if !reflect.DeepEqual(args, tc.want) {
+				t.Errorf("applyTo() =\n%+v\nwant\n%+v", args, tc.want)
+			}
+		})
+	}
+}
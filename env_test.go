@@ -0,0 +1,226 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseInheritEnv(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		mode    string
+		allow   []string
+		want    string
+		wantErr string
+	}{
+		{name: "default", want: InheritFull},
+		{name: "allow list implies allow", allow: []string{"PATH"}, want: InheritAllow},
+		{name: "full", mode: "full", want: InheritFull},
+		{name: "case and spaces", mode: " None ", want: InheritNone},
+		{name: "allow", mode: "allow", allow: []string{"PATH", "GO*"}, want: InheritAllow},
+		{name: "allow without list", mode: "allow", wantErr: "必须提供 inherit_env_allow"},
+		{name: "full with list", mode: "full", allow: []string{"PATH"}, wantErr: "只能与 inherit_env=allow 一起使用"},
+		{name: "none with list", mode: "none", allow: []string{"PATH"}, wantErr: "只能与 inherit_env=allow 一起使用"},
+		{name: "invalid mode", mode: "some", wantErr: "只能是 full、allow 或 none"},
+		{name: "invalid pattern", mode: "allow", allow: []string{"GO["}, wantErr: "不是合法的通配模式"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseInheritEnv(tc.mode, tc.allow)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("parseInheritEnv() error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("parseInheritEnv() = %q, %v; want %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeEnv(t *testing.T) {
+	t.Setenv("ENVTEST_KEEP", "1")
+	t.Setenv("ENVTEST_DROP", "2")
+	t.Setenv("ENVTEST_OVERRIDE", "old")
+
+	// envTestVars 只保留测试设置的变量，忽略运行环境中的其它变量
+	envTestVars := func(env []string) []string {
+		var vars []string
+		for _, e := range env {
+			if strings.HasPrefix(e, "ENVTEST_") {
+				vars = append(vars, e)
+			}
+		}
+		return vars
+	}
+
+	for _, tc := range []struct {
+		name      string
+		spec      LaunchSpec
+		env       map[string]string
+		want      []string
+		wantOther bool // 是否继承了测试变量以外的变量
+	}{
+		{
+			name: "full without changes inherits directly",
+			spec: LaunchSpec{},
+			want: nil,
+		},
+		{
+			name:      "full with env and unset",
+			spec:      LaunchSpec{UnsetEnv: []string{"ENVTEST_D*"}},
+			env:       map[string]string{"ENVTEST_OVERRIDE": "new", "ENVTEST_ADDED": "3"},
+			want:      []string{"ENVTEST_ADDED=3", "ENVTEST_KEEP=1", "ENVTEST_OVERRIDE=new"},
+			wantOther: true,
+		},
+		{
+			name: "allow",
+			spec: LaunchSpec{InheritEnv: InheritAllow, InheritAllow: []string{"ENVTEST_KEEP", "ENVTEST_O*"}},
+			want: []string{"ENVTEST_KEEP=1", "ENVTEST_OVERRIDE=old"},
+		},
+		{
+			name: "allow with unset",
+			spec: LaunchSpec{InheritEnv: InheritAllow, InheritAllow: []string{"ENVTEST_*"}, UnsetEnv: []string{"ENVTEST_DROP"}},
+			want: []string{"ENVTEST_KEEP=1", "ENVTEST_OVERRIDE=old"},
+		},
+		{
+			name: "none keeps only env",
+			spec: LaunchSpec{InheritEnv: InheritNone},
+			env:  map[string]string{"ENVTEST_ADDED": "3"},
+			want: []string{"ENVTEST_ADDED=3"},
+		},
+		{
+			name: "unset does not remove explicit env",
+			spec: LaunchSpec{InheritEnv: InheritNone, UnsetEnv: []string{"ENVTEST_*"}},
+			env:  map[string]string{"ENVTEST_ADDED": "3"},
+			want: []string{"ENVTEST_ADDED=3"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			merged := mergeEnv(tc.spec, tc.env)
+			if tc.want == nil {
+				if merged != nil {
+					t.Errorf("mergeEnv() = %q, want nil", merged)
+				}
+				return
+			}
+			if got := envTestVars(merged); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("mergeEnv() test vars = %q, want %q", got, tc.want)
+			}
+			if other := len(merged) > len(tc.want); other != tc.wantOther {
+				t.Errorf("mergeEnv() inherited other vars = %v, want %v (%q)", other, tc.wantOther, merged)
+			}
+		})
+	}
+}
+
+func TestIsSecretEnv(t *testing.T) {
+	for name, want := range map[string]bool{
+		"DB_PASSWORD":           true,
+		"GITHUB_TOKEN":          true,
+		"STRIPE_SECRET_KEY":     true,
+		"api-key":               true,
+		"aws.secret.access":     true,
+		"DATABASE_DSN":          true,
+		"SESSION":               true,
+		"OPENAI_APIKEY":         true,
+		"PATH":                  false,
+		"KEYBOARD_LAYOUT":       false,
+		"MONKEY":                false,
+		"PASSPORT_ID":           false,
+		"AUTHOR_NAME":           false,
+		"TOKENIZER_PARALLELISM": false,
+		"":                      false,
+	} {
+		if got := isSecretEnv(name); got != want {
+			t.Errorf("isSecretEnv(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestMaskEnvValue(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"DB_PASSWORD", "hunter", "****（6 个字符）"},
+		{"API_TOKEN", "", ""},
+		{"PWD", "/home/app", "/home/app"},
+		{"PORT", "8080", "8080"},
+		{"DATABASE_URL", "postgres://app:s3cret@db:5432/app", "postgres://app:****@db:5432/app"},
+		{"REDIS_URL", "redis://db:6379/0", "redis://db:6379/0"},
+		{"UPSTREAMS", "http://a:x@h1,http://b:y@h2", "http://a:****@h1,http://b:****@h2"},
+	} {
+		if got := maskEnvValue(tc.name, tc.value); got != tc.want {
+			t.Errorf("maskEnvValue(%q, %q) = %q, want %q", tc.name, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestEnvReport(t *testing.T) {
+	t.Setenv("ENVTEST_DROP", "x")
+
+	custom := map[string]string{"PORT": "8080", "DB_PASSWORD": "hunter", "STRIPE_SK": "sk_live_123", "DATABASE_URL": "postgres://app:s3cret@db/app"}
+	sources := map[string]string{"STRIPE_SK": ".env.local"}
+	cmdEnv := []string{"DATABASE_URL=postgres://app:s3cret@db/app", "DB_PASSWORD=hunter", "PATH=/usr/bin", "PORT=8080", "STRIPE_SK=sk_live_123"}
+
+	for _, tc := range []struct {
+		name    string
+		spec    LaunchSpec
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "full lists custom and unset vars",
+			spec: LaunchSpec{UnsetEnv: []string{"ENVTEST_DROP"}},
+			want: []string{
+				"继承全部（4 个自定义，1 个未继承），共 5 个",
+				"  PORT=8080\n",
+				"  DB_PASSWORD=****（6 个字符）\n",
+				"  DATABASE_URL=postgres://app:****@db/app\n",
+				"  STRIPE_SK=（来自 .env.local，值已隐藏）\n",
+				"  未继承: ENVTEST_DROP\n",
+			},
+			notWant: []string{"PATH=", "hunter", "s3cret", "sk_live_123"},
+		},
+		{
+			name: "allow lists all vars and marks custom ones",
+			spec: LaunchSpec{InheritEnv: InheritAllow, InheritAllow: []string{"PATH"}},
+			want: []string{
+				"只继承 PATH，共 5 个",
+				"  PATH=/usr/bin\n",
+				"  PORT=8080（自定义）\n",
+				"  DB_PASSWORD=****（6 个字符）（自定义）\n",
+				"  STRIPE_SK=（来自 .env.local，值已隐藏）\n",
+			},
+			notWant: []string{"未继承", "hunter", "s3cret", "sk_live_123"},
+		},
+		{
+			name:    "none",
+			spec:    LaunchSpec{InheritEnv: InheritNone},
+			want:    []string{"不继承，共 5 个", "  PATH=/usr/bin\n"},
+			notWant: []string{"hunter", "s3cret", "sk_live_123"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			report := envReport(tc.spec, custom, sources, cmdEnv)
+			for _, want := range tc.want {
+				if !strings.Contains(report, want) {
+					t.Errorf("report does not contain %q:\n%s", want, report)
+				}
+			}
+			for _, notWant := range tc.notWant {
+				if strings.Contains(report, notWant) {
+					t.Errorf("report contains %q:\n%s", notWant, report)
+				}
+			}
+		})
+	}
+
+	if report := envReport(LaunchSpec{}, nil, nil, nil); report != "" {
+		t.Errorf("envReport() with inherited env = %q, want empty", report)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// envKeyPattern dotenv 中合法的变量名
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// launchEnv 计算进程的自定义环境变量：按顺序加载 env_files（后面的覆盖前面的），再用 env 覆盖
+// 不包含继承自当前进程的环境变量，两者都为空时返回 nil
+// 同时返回最终值来自 env_files 的变量及其文件（被 env 覆盖的不算），报告时只列出名称不显示值
+func launchEnv(spec LaunchSpec) (map[string]string, map[string]string, error) {
+	if len(spec.EnvFiles) == 0 {
+		return spec.Env, nil, nil
+	}
+	env, sources, err := loadEnvFiles(spec.EnvFiles, resolveWorkDir(spec))
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, value := range spec.Env {
+		env[key] = value
+		delete(sources, key)
+	}
+	return env, sources, nil
+}
+
+// loadEnvFiles 按顺序加载 dotenv 文件，相对路径基于 dir，返回变量和定义它的文件（按参数中的写法）
+// 文件中的 ${VAR} 可以引用之前文件或本文件前面定义的变量，以及当前进程的环境变量
+func loadEnvFiles(paths []string, dir string) (map[string]string, map[string]string, error) {
+	env := make(map[string]string)
+	sources := make(map[string]string)
+	for _, name := range paths {
+		path := name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取环境变量文件失败: %w", err)
+		}
+		fileEnv := make(map[string]string, len(env))
+		for key, value := range env {
+			fileEnv[key] = value
+		}
+		if err := parseDotenv(string(data), fileEnv); err != nil {
+			return nil, nil, fmt.Errorf("环境变量文件 %s %w", path, err)
+		}
+		for key, value := range fileEnv {
+			if old, ok := env[key]; !ok || old != value {
+				sources[key] = name
+			}
+		}
+		env = fileEnv
+		GetLogger().Info("已加载环境变量文件 %s", path)
+	}
+	return env, sources, nil
+}
+
+// parseDotenv 解析 dotenv 内容并写入 env，支持：
+//   - # 注释（整行，或未加引号的值后以空白开头的 #）
+//   - export KEY=VALUE
+//   - 单引号：原样保留，不转义不展开
+//   - 双引号：支持 \n \t \" \\ \$ 转义和 ${VAR} 展开，可以跨行
+//   - ${VAR}、${VAR:-默认值}、$VAR 展开
+func parseDotenv(content string, env map[string]string) error {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// export 与变量名之间可以是空格或制表符
+		if rest, ok := strings.CutPrefix(line, "export"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			line = strings.TrimSpace(rest)
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok {
+			return fmt.Errorf("第 %d 行格式错误，应为 KEY=VALUE: %s", lineNo, line)
+		}
+		if !envKeyPattern.MatchString(key) {
+			return fmt.Errorf("第 %d 行变量名 '%s' 不合法", lineNo, key)
+		}
+		value = strings.TrimLeft(value, " \t")
+
+		if value != "" && (value[0] == '"' || value[0] == '\'') {
+			quote := value[0]
+			// 引号内的值可以跨行，找到未转义的结束引号为止
+			raw := value[1:]
+			end := closingQuote(raw, quote)
+			for end < 0 && i+1 < len(lines) {
+				i++
+				raw += "\n" + lines[i]
+				end = closingQuote(raw, quote)
+			}
+			if end < 0 {
+				return fmt.Errorf("第 %d 行的 %c 引号没有闭合", lineNo, quote)
+			}
+			if rest := strings.TrimSpace(raw[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				return fmt.Errorf("第 %d 行引号后有多余内容: %s", lineNo, rest)
+			}
+			raw = raw[:end]
+			if quote == '\'' {
+				env[key] = raw
+			} else {
+				env[key] = expandEnvValue(raw, env, true)
+			}
+			continue
+		}
+
+		// 未加引号：以空白开头的 # 之后为注释
+		for j := 0; j < len(value); j++ {
+			if value[j] == '#' && (j == 0 || value[j-1] == ' ' || value[j-1] == '\t') {
+				value = value[:j]
+				break
+			}
+		}
+		env[key] = expandEnvValue(strings.TrimSpace(value), env, false)
+	}
+	return nil
+}
+
+// closingQuote 查找结束引号的位置，双引号内跳过反斜杠转义
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// expandEnvValue 展开 ${VAR}、${VAR:-默认值}、$VAR，escapes 为 true 时处理双引号内的反斜杠转义
+// 变量优先取已解析的 env，其次取当前进程的环境变量，都没有时为空
+func expandEnvValue(s string, env map[string]string, escapes bool) string {
+	lookup := func(name string) (string, bool) {
+		if value, ok := env[name]; ok {
+			return value, true
+		}
+		return os.LookupEnv(name)
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if escapes && c == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				builder.WriteByte('\n')
+			case 'r':
+				builder.WriteByte('\r')
+			case 't':
+				builder.WriteByte('\t')
+			case '"', '\\', '$':
+				builder.WriteByte(s[i])
+			default:
+				builder.WriteByte('\\')
+				builder.WriteByte(s[i])
+			}
+			continue
+		}
+		if c != '$' || i+1 >= len(s) {
+			builder.WriteByte(c)
+			continue
+		}
+
+		if s[i+1] == '{' {
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				builder.WriteByte(c)
+				continue
+			}
+			expr := s[i+2 : i+2+end]
+			name, fallback, hasDefault := strings.Cut(expr, ":-")
+			if value, ok := lookup(name); ok && (value != "" || !hasDefault) {
+				builder.WriteString(value)
+			} else if hasDefault {
+				builder.WriteString(fallback)
+			}
+			i += 2 + end
+			continue
+		}
+
+		j := i + 1
+		for j < len(s) && (s[j] == '_' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= 'a' && s[j] <= 'z' || j > i+1 && s[j] >= '0' && s[j] <= '9') {
+			j++
+		}
+		if j == i+1 {
+			builder.WriteByte(c)
+			continue
+		}
+		value, _ := lookup(s[i+1 : j])
+		builder.WriteString(value)
+		i = j - 1
+	}
+	return builder.String()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	t.Setenv("DOTENV_TEST_HOME", "/home/test")
+	t.Setenv("DOTENV_TEST_EMPTY", "")
+
+	for _, tc := range []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{
+			name:    "plain values and comments",
+			content: "# comment\n\nA=1\nB = two words \nC=x # trailing comment\nD=x#not-comment\n",
+			want:    map[string]string{"A": "1", "B": "two words", "C": "x", "D": "x#not-comment"},
+		},
+		{
+			name:    "export prefix with space or tab",
+			content: "export A=1\nexport\tB=2\nexport  \t C=3\nexportD=4\n",
+			want:    map[string]string{"A": "1", "B": "2", "C": "3", "exportD": "4"},
+		},
+		{
+			name:    "hash inside quotes",
+			content: "A=\"x # y\"\nB='x # y' # comment\nC=\"#\"\n",
+			want:    map[string]string{"A": "x # y", "B": "x # y", "C": "#"},
+		},
+		{
+			name:    "multi-line double quotes",
+			content: "CERT=\"-----BEGIN-----\nabc\n-----END-----\"\nNEXT=1\n",
+			want:    map[string]string{"CERT": "-----BEGIN-----\nabc\n-----END-----", "NEXT": "1"},
+		},
+		{
+			name:    "escapes only in double quotes",
+			content: `A="line1\nline2\t\"q\" \\ \$HOME"` + "\n" + `B='raw\n$HOME'` + "\n" + `C=raw\n` + "\n",
+			want:    map[string]string{"A": "line1\nline2\t\"q\" \\ $HOME", "B": `raw\n$HOME`, "C": `raw\n`},
+		},
+		{
+			name: "variable expansion",
+			content: strings.Join([]string{
+				"HOST=localhost",
+				"URL=http://${HOST}:${PORT:-8080}/$HOST",
+				"HOME_DIR=${DOTENV_TEST_HOME}/app",
+				`QUOTED="${HOST}-x"`,
+				"SINGLE='${HOST}'",
+				"MISSING=[${DOTENV_TEST_MISSING}]",
+				"FALLBACK_EMPTY=${DOTENV_TEST_EMPTY:-default}",
+				"FALLBACK_SET=${HOST:-default}",
+				"DOLLAR=cost $5 and $",
+			}, "\n"),
+			want: map[string]string{
+				"HOST":           "localhost",
+				"URL":            "http://localhost:8080/localhost",
+				"HOME_DIR":       "/home/test/app",
+				"QUOTED":         "localhost-x",
+				"SINGLE":         "${HOST}",
+				"MISSING":        "[]",
+				"FALLBACK_EMPTY": "default",
+				"FALLBACK_SET":   "localhost",
+				"DOLLAR":         "cost $5 and $",
+			},
+		},
+		{
+			name:    "later definitions override earlier ones",
+			content: "A=1\nA=${A}2\n",
+			want:    map[string]string{"A": "12"},
+		},
+		{
+			name:    "CRLF line endings",
+			content: "A=1\r\nB=\"x\r\ny\"\r\n",
+			want:    map[string]string{"A": "1", "B": "x\ny"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := make(map[string]string)
+			if err := parseDotenv(tc.content, env); err != nil {
+				t.Fatalf("parseDotenv: %v", err)
+			}
+			if !reflect.DeepEqual(env, tc.want) {
+				t.Errorf("parseDotenv() = %q, want %q", env, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseDotenvErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"missing equals", "A=1\nJUSTNAME\n", "第 2 行格式错误"},
+		{"invalid name", "1A=1\n", "变量名 '1A' 不合法"},
+		{"unclosed double quote", "A=\"abc\nB=1\n", "第 1 行的 \" 引号没有闭合"},
+		{"unclosed single quote", "A='abc\n", "第 1 行的 ' 引号没有闭合"},
+		{"content after quote", "A=\"x\" y\n", "第 1 行引号后有多余内容"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := parseDotenv(tc.content, make(map[string]string))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("parseDotenv() error = %v, want containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadEnvFilesSources(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		".env":       "DATABASE_URL=postgres://db/app\nPORT=8080\nLOG=info\n",
+		".env.local": "PORT=9090\nLOG=info\nSTRIPE_SK=sk_test\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spec := LaunchSpec{WorkDir: dir, EnvFiles: []string{".env", ".env.local"}, Env: map[string]string{"LOG": "debug"}}
+	env, sources, err := launchEnv(spec)
+	if err != nil {
+		t.Fatalf("launchEnv: %v", err)
+	}
+	wantEnv := map[string]string{"DATABASE_URL": "postgres://db/app", "PORT": "9090", "LOG": "debug", "STRIPE_SK": "sk_test"}
+	if !reflect.DeepEqual(env, wantEnv) {
+		t.Errorf("env = %q, want %q", env, wantEnv)
+	}
+	// 被 env 覆盖的 LOG 不算来自文件；值相同的重复定义仍算最先定义它的文件
+	wantSources := map[string]string{"DATABASE_URL": ".env", "PORT": ".env.local", "STRIPE_SK": ".env.local"}
+	if !reflect.DeepEqual(sources, wantSources) {
+		t.Errorf("sources = %q, want %q", sources, wantSources)
+	}
+
+	if _, _, err := launchEnv(LaunchSpec{WorkDir: dir, EnvFiles: []string{"missing.env"}}); err == nil {
+		t.Error("launchEnv with a missing file succeeded, want error")
+	}
+}
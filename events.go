@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// 进程事件类型
+const (
+	EventStarted    = "started"    // 进程已启动
+	EventHealthy    = "healthy"    // 健康检查通过
+	EventExited     = "exited"     // 进程退出（主动终止或退出码为 0）
+	EventCrashed    = "crashed"    // 进程意外退出且退出码非 0 或被信号终止
+	EventLogMatch   = "log_match"  // 日志匹配了 start_process 的 watch_pattern
+	EventRestarting = "restarting" // 按重启策略即将重启意外退出的进程
+	EventCrashLoop  = "crash_loop" // 连续重启次数超过上限，已停止自动重启
+	EventUnhealthy  = "unhealthy"  // 存活探测连续失败达到阈值，进程可能已卡死
+	EventRecovered  = "recovered"  // 不健康的进程存活探测恢复正常
+)
+
+// eventQueueSize 待推送事件队列长度，客户端处理不过来时丢弃新事件
+const eventQueueSize = 256
+
+// ProcessEvent 进程生命周期或日志事件
+type ProcessEvent struct {
+	Type    string
+	Process string
+	Message string
+	Time    time.Time
+	Level   mcp.LoggingLevel // 推送给客户端的日志级别
+	Data    map[string]any   // 事件相关的附加信息（PID、退出码、日志行等）
+}
+
+// eventBus 将进程事件分发给订阅者，分发在独立协程中进行，不阻塞日志处理和进程监控
+type eventBus struct {
+	mu        sync.RWMutex
+	listeners []func(ProcessEvent)
+	queue     chan ProcessEvent
+	startOnce sync.Once
+}
+
+var processEvents = &eventBus{queue: make(chan ProcessEvent, eventQueueSize)}
+
+// Subscribe 注册事件订阅者
+func (b *eventBus) Subscribe(listener func(ProcessEvent)) {
+	b.mu.Lock()
+	b.listeners = append(b.listeners, listener)
+	b.mu.Unlock()
+	b.startOnce.Do(func() { go b.dispatch() })
+}
+
+// Emit 发布事件（非阻塞，没有订阅者时直接丢弃）
+func (b *eventBus) Emit(event ProcessEvent) {
+	b.mu.RLock()
+	hasListeners := len(b.listeners) > 0
+	b.mu.RUnlock()
+	if !hasListeners {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	select {
+	case b.queue <- event:
+	default:
+		GetLogger().Debug("事件队列已满，丢弃事件: %s %s", event.Process, event.Type)
+	}
+}
+
+// dispatch 事件分发协程
+func (b *eventBus) dispatch() {
+	for event := range b.queue {
+		b.mu.RLock()
+		listeners := b.listeners
+		b.mu.RUnlock()
+		for _, listener := range listeners {
+			listener(event)
+		}
+	}
+}
+
+// RegisterNotifications 将进程事件作为 MCP 日志通知推送给所有已连接的客户端
+// 客户端需要先调用 logging/setLevel 才会收到通知
+func RegisterNotifications(server *mcp.Server) {
+	processEvents.Subscribe(func(event ProcessEvent) {
+		params := &mcp.LoggingMessageParams{
+			Level:  event.Level,
+			Logger: "process/" + event.Process,
+			Data:   event.payload(),
+		}
+		for ss := range server.Sessions() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := ss.Log(ctx, params); err != nil {
+				GetLogger().Debug("推送事件通知失败: %v", err)
+			}
+			cancel()
+		}
+	})
+}
+
+// payload 通知中携带的数据
+func (e ProcessEvent) payload() map[string]any {
+	data := map[string]any{
+		"event":   e.Type,
+		"process": e.Process,
+		"message": e.Message,
+		"time":    e.Time.Format(time.RFC3339Nano),
+	}
+	for key, value := range e.Data {
+		data[key] = value
+	}
+	return data
+}
+
+// exitEvent 根据退出记录生成退出事件
+func exitEvent(record *ExitRecord) ProcessEvent {
+	event := ProcessEvent{
+		Type:    EventExited,
+		Process: record.Name,
+		Message: fmt.Sprintf("进程 %s 已退出（%s，运行 %v）", record.Name, record.Cause(), record.Uptime.Round(time.Millisecond)),
+		Time:    record.ExitTime,
+		Level:   "info",
+		Data: map[string]any{
+			"pid":       record.PID,
+			"exit_code": record.ExitCode,
+			"expected":  record.Expected,
+			"cause":     record.Cause(),
+		},
+	}
+	if !record.Expected {
+		if record.ExitCode == 0 {
+			event.Level = "warning"
+		} else {
+			event.Type = EventCrashed
+			event.Level = "error"
+		}
+	}
+	if record.Signal != "" {
+		event.Data["signal"] = record.Signal
+	}
+	return event
+}
+
+// logMatchEvent 日志匹配 watch_pattern 时的事件
+func logMatchEvent(info *ProcessInfo, entry LogEntry) ProcessEvent {
+	level := mcp.LoggingLevel("notice")
+	if entry.Level >= LevelError {
+		level = "error"
+	}
+	return ProcessEvent{
+		Type:    EventLogMatch,
+		Process: info.Name,
+		Message: fmt.Sprintf("进程 %s 输出了匹配 %s 的日志", info.Name, info.Spec.WatchPattern.String()),
+		Time:    entry.Time,
+		Level:   level,
+		Data: map[string]any{
+			"pattern": info.Spec.WatchPattern.String(),
+			"stream":  entry.Stream,
+			"line":    entry.Line,
+		},
+	}
+}
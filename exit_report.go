@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// exitReportLogLines 退出记录中保留的最后日志条数
+const exitReportLogLines = 30
+
+// ExitRecord 进程退出记录，进程退出（包括被 kill_process 清理）后仍然保留
+type ExitRecord struct {
+	Name      string
+	PID       int
+	Command   string
+	ExitCode  int    // 退出码，-1 表示被信号终止
+	Signal    string // 导致退出的信号（仅 Unix）
+	Error     string // Wait() 返回的错误
+	StartTime time.Time
+	ExitTime  time.Time
+	Uptime    time.Duration
+	Expected  bool       // 是否由 kill_process / 重启主动终止
+	LastLogs  []LogEntry // 退出前的最后几条日志
+
+	reported atomic.Bool // 是否已在工具调用中提示过
+}
+
+// recordExit 在进程退出后生成退出记录（需在日志处理完成后调用，以包含最后的日志）
+func (pm *ProcessManager) recordExit(info *ProcessInfo, err error) *ExitRecord {
+	record := &ExitRecord{
+		Name:      info.Name,
+		PID:       info.Cmd.Process.Pid,
+		Command:   strings.Join(info.Cmd.Args, " "),
+		ExitCode:  info.Cmd.ProcessState.ExitCode(),
+		Signal:    exitSignal(info.Cmd.ProcessState),
+		StartTime: info.StartTime,
+		ExitTime:  info.exitTime,
+		Uptime:    info.exitTime.Sub(info.StartTime),
+		Expected:  info.stopRequested.Load(),
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			// 非退出码错误（如 I/O 错误），退出码未知
+			record.ExitCode = -1
+		}
+		record.Error = err.Error()
+	}
+	record.LastLogs, _ = info.QueryLogs(LogQuery{Tail: exitReportLogLines})
+
+	pm.exits.Store(info.Name, record)
+	GetLogger().Info("已记录进程 %s 的退出信息: %s", info.Name, record.Cause())
+	return record
+}
+
+// GetExitRecord 获取进程最近一次的退出记录
+func (pm *ProcessManager) GetExitRecord(name string) (*ExitRecord, bool) {
+	val, ok := pm.exits.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return val.(*ExitRecord), true
+}
+
+// ListExitRecords 返回所有退出记录，最近退出的在前
+func (pm *ProcessManager) ListExitRecords() []*ExitRecord {
+	var list []*ExitRecord
+	pm.exits.Range(func(key, value any) bool {
+		list = append(list, value.(*ExitRecord))
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ExitTime.After(list[j].ExitTime)
+	})
+	return list
+}
+
+// TakeExitNotice 如果进程意外退出且尚未提示过，返回退出提示（只返回一次），否则返回空字符串
+func (pm *ProcessManager) TakeExitNotice(name string) string {
+	record, ok := pm.GetExitRecord(name)
+	if !ok || record.Expected {
+		return ""
+	}
+	if !record.reported.CompareAndSwap(false, true) {
+		return ""
+	}
+	return record.Report()
+}
+
+// Cause 退出原因描述
+func (r *ExitRecord) Cause() string {
+	switch {
+	case r.Signal != "":
+		return fmt.Sprintf("被信号 %s 终止", r.Signal)
+	case r.ExitCode >= 0:
+		return fmt.Sprintf("退出码 %d", r.ExitCode)
+	case r.Error != "":
+		return r.Error
+	}
+	return "原因未知"
+}
+
+// Summary 单行摘要，如 "进程 api 已于 12s 前退出（退出码 2，运行 3m0s）"
+func (r *ExitRecord) Summary() string {
+	kind := "意外退出"
+	if r.Expected {
+		kind = "被主动终止"
+	}
+	return fmt.Sprintf("进程 %s 已于 %v 前%s（%s，运行 %v）",
+		r.Name,
+		time.Since(r.ExitTime).Round(time.Second),
+		kind,
+		r.Cause(),
+		r.Uptime.Round(time.Second))
+}
+
+// Report 完整的退出报告，包括最后的日志
+func (r *ExitRecord) Report() string {
+	var builder strings.Builder
+	builder.WriteString("⚠️ " + r.Summary() + "\n")
+	builder.WriteString(fmt.Sprintf("PID: %d\n", r.PID))
+	builder.WriteString(fmt.Sprintf("命令: %s\n", r.Command))
+	builder.WriteString(fmt.Sprintf("退出时间: %s\n", r.ExitTime.Format(time.RFC3339)))
+	if len(r.LastLogs) > 0 {
+		builder.WriteString(fmt.Sprintf("\n最后 %d 条日志:\n", len(r.LastLogs)))
+		builder.WriteString(formatLogEntries(r.LastLogs, false))
+		builder.WriteString("\n")
+	} else {
+		builder.WriteString("\n(退出前没有日志输出)\n")
+	}
+	return builder.String()
+}
+
+// exitRecordHint 进程不存在时的补充说明：如果有退出记录则附带摘要
+func exitRecordHint(name string) string {
+	record, ok := processManager.GetExitRecord(name)
+	if !ok {
+		return ""
+	}
+	record.reported.Store(true)
+	return "\n" + record.Summary() + "\n提示：使用 get_exit_report 查看退出前的日志"
+}
+
+// structured 退出记录的结构化形式
+func (r *ExitRecord) structured() map[string]any {
+	lastLogs := make([]string, 0, len(r.LastLogs))
+	for _, entry := range r.LastLogs {
+		lastLogs = append(lastLogs, formatLogEntry(entry, false))
+	}
+	item := map[string]any{
+		"name":           r.Name,
+		"pid":            r.PID,
+		"command":        r.Command,
+		"exit_code":      r.ExitCode,
+		"start_time":     r.StartTime.Format(time.RFC3339),
+		"exit_time":      r.ExitTime.Format(time.RFC3339),
+		"uptime_seconds": int64(r.Uptime.Seconds()),
+		"expected":       r.Expected,
+		"cause":          r.Cause(),
+		"last_logs":      lastLogs,
+	}
+	if r.Signal != "" {
+		item["signal"] = r.Signal
+	}
+	if r.Error != "" {
+		item["error"] = r.Error
+	}
+	return item
+}
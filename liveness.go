@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 进程判定为不健康后的处理（start_process 的 liveness.on_unhealthy 参数）
+const (
+	LivenessActionNone    = "none"    // 只标记为不健康并推送事件（默认）
+	LivenessActionDump    = "dump"    // 通过 pprof 获取 goroutine 堆栈保存到 logs 目录
+	LivenessActionRestart = "restart" // 先获取 goroutine 堆栈（pprof 不可用时发送 SIGQUIT），再按启动参数重启进程
+)
+
+const (
+	defaultLivenessInterval  = 10 * time.Second
+	defaultLivenessThreshold = 3
+	livenessHistorySize      = 20
+)
+
+// LivenessSpec 存活探测配置（start_process 的 liveness 参数，.gomcp.json 中服务的 liveness 字段）
+// 启动成功后在后台按间隔持续探测，连续失败达到阈值时判定为不健康
+type LivenessSpec struct {
+	Type    string   `json:"type,omitempty" jsonschema:"探测方式：http（默认，请求 url 或 health_check_url）、tcp（连接 address）、command（执行 command 退出码为0）"`
+	URL     string   `json:"url,omitempty" jsonschema:"http 方式请求的URL，默认为 health_check_url"`
+	Address string   `json:"address,omitempty" jsonschema:"tcp 方式连接的地址，如 127.0.0.1:9090 或 :9090"`
+	Command string   `json:"command,omitempty" jsonschema:"command 方式执行的命令（可执行文件名），在进程的工作目录中以进程的环境变量执行"`
+	Args    []string `json:"args,omitempty" jsonschema:"command 方式的命令参数"`
+
+	ExpectStatus []int  `json:"expect_status,omitempty" jsonschema:"http 方式期望的状态码列表，默认任意 2xx"`
+	BodyPattern  string `json:"body_pattern,omitempty" jsonschema:"http 方式要求响应体匹配的正则表达式"`
+	JSONField    string `json:"json_field,omitempty" jsonschema:"http 方式要求响应体 JSON 包含的字段（用 . 分隔的路径）"`
+	JSONEquals   string `json:"json_equals,omitempty" jsonschema:"json_field 的期望值"`
+
+	IntervalSeconds  int    `json:"interval_seconds,omitempty" jsonschema:"探测间隔秒数，默认10"`
+	TimeoutMs        int    `json:"timeout_ms,omitempty" jsonschema:"单次探测的超时毫秒数，默认 http 2000、command 5000"`
+	FailureThreshold int    `json:"failure_threshold,omitempty" jsonschema:"连续失败多少次判定为不健康，默认3"`
+	OnUnhealthy      string `json:"on_unhealthy,omitempty" jsonschema:"判定为不健康后的处理：none（默认，只标记并推送 unhealthy 事件）、dump（请求 /debug/pprof/goroutine?debug=2 把 goroutine 堆栈保存到 logs 目录，需要进程导入 net/http/pprof）、restart（先保存 goroutine 堆栈，pprof 不可用时发送 SIGQUIT，再按启动参数重启进程）"`
+}
+
+// newLivenessProbe 校验存活探测配置并创建探测，复用就绪探测的实现
+func newLivenessProbe(spec LaunchSpec) (ReadinessProbe, error) {
+	l := spec.Liveness
+	kind := strings.ToLower(l.Type)
+	if kind == "" {
+		kind = ProbeHTTP
+	}
+	switch kind {
+	case ProbeHTTP, ProbeTCP, ProbeCommand:
+	default:
+		return nil, fmt.Errorf("liveness.type 只能是 http、tcp 或 command，收到 '%s'", l.Type)
+	}
+	switch strings.ToLower(l.OnUnhealthy) {
+	case "", LivenessActionNone, LivenessActionDump, LivenessActionRestart:
+	default:
+		return nil, fmt.Errorf("liveness.on_unhealthy 只能是 none、dump 或 restart，收到 '%s'", l.OnUnhealthy)
+	}
+	if l.IntervalSeconds < 0 || l.TimeoutMs < 0 || l.FailureThreshold < 0 {
+		return nil, fmt.Errorf("liveness 的 interval_seconds、timeout_ms、failure_threshold 不能为负数")
+	}
+
+	return newProbe("liveness", &ReadinessSpec{
+		Type:             kind,
+		URL:              l.URL,
+		Address:          l.Address,
+		Command:          l.Command,
+		Args:             l.Args,
+		ExpectStatus:     l.ExpectStatus,
+		BodyPattern:      l.BodyPattern,
+		JSONField:        l.JSONField,
+		JSONEquals:       l.JSONEquals,
+		AttemptTimeoutMs: l.TimeoutMs,
+	}, spec.HealthCheckURL, spec.HealthCheckMethod)
+}
+
+// interval 两次探测之间的间隔
+func (l *LivenessSpec) interval() time.Duration {
+	if l.IntervalSeconds <= 0 {
+		return defaultLivenessInterval
+	}
+	return time.Duration(l.IntervalSeconds) * time.Second
+}
+
+// threshold 判定为不健康的连续失败次数
+func (l *LivenessSpec) threshold() int {
+	if l.FailureThreshold <= 0 {
+		return defaultLivenessThreshold
+	}
+	return l.FailureThreshold
+}
+
+// action 不健康后的处理方式
+func (l *LivenessSpec) action() string {
+	if l.OnUnhealthy == "" {
+		return LivenessActionNone
+	}
+	return strings.ToLower(l.OnUnhealthy)
+}
+
+// LivenessCheck 一次存活探测的结果
+type LivenessCheck struct {
+	Time     time.Time
+	OK       bool
+	Duration time.Duration
+	Error    string
+}
+
+// livenessMonitor 在进程运行期间按间隔执行存活探测，每个进程实例一个，进程退出时结束
+type livenessMonitor struct {
+	spec  *LivenessSpec
+	probe ReadinessProbe
+
+	mu         sync.Mutex
+	history    []LivenessCheck
+	failures   int       // 当前连续失败次数
+	unhealthy  bool      // 连续失败次数达到阈值后为 true，探测成功后恢复
+	since      time.Time // 进入不健康状态的时间
+	lastAction string    // 最近一次不健康处理的结果
+}
+
+// StartLiveness 开始对健康检查通过的进程执行存活探测
+func (pm *ProcessManager) StartLiveness(info *ProcessInfo, probe ReadinessProbe) {
+	m := &livenessMonitor{spec: info.Spec.Liveness, probe: probe}
+	info.liveness.Store(m)
+	GetLogger().Info("进程 %s 开启存活探测: %s，每 %v 一次", info.Name, probe.Describe(), m.spec.interval())
+	go m.run(info)
+}
+
+// run 探测循环，进程退出后结束
+func (m *livenessMonitor) run(info *ProcessInfo) {
+	ticker := time.NewTicker(m.spec.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-info.waitDone:
+			return
+		case <-ticker.C:
+		}
+
+		// 进程退出时中断正在进行的探测
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-info.waitDone:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		start := time.Now()
+		err := m.probe.Check(ctx, info)
+		cancel()
+
+		// 探测期间进程退出不算探测失败，由退出记录说明原因
+		select {
+		case <-info.waitDone:
+			return
+		default:
+		}
+		if m.record(info, LivenessCheck{Time: start, OK: err == nil, Duration: time.Since(start)}, err) {
+			m.handleUnhealthy(info, err)
+		}
+	}
+}
+
+// record 记录探测结果并更新状态，返回是否刚刚进入不健康状态
+func (m *livenessMonitor) record(info *ProcessInfo, check LivenessCheck, err error) bool {
+	if err != nil {
+		check.Error = err.Error()
+	}
+
+	m.mu.Lock()
+	m.history = append(m.history, check)
+	if len(m.history) > livenessHistorySize {
+		m.history = m.history[len(m.history)-livenessHistorySize:]
+	}
+	if err == nil {
+		recovered := m.unhealthy
+		failures := m.failures
+		m.failures = 0
+		m.unhealthy = false
+		m.mu.Unlock()
+
+		if recovered {
+			GetLogger().Info("进程 %s 存活探测恢复正常（之前连续失败 %d 次）", info.Name, failures)
+			processEvents.Emit(ProcessEvent{
+				Type:    EventRecovered,
+				Process: info.Name,
+				Message: fmt.Sprintf("进程 %s 存活探测恢复正常（之前连续失败 %d 次）", info.Name, failures),
+				Level:   "notice",
+				Data:    map[string]any{"pid": info.Cmd.Process.Pid, "failures": failures},
+			})
+		}
+		return false
+	}
+
+	m.failures++
+	becameUnhealthy := !m.unhealthy && m.failures >= m.spec.threshold()
+	if becameUnhealthy {
+		m.unhealthy = true
+		m.since = check.Time
+	}
+	m.mu.Unlock()
+	if !becameUnhealthy {
+		GetLogger().Debug("进程 %s 存活探测失败: %v", info.Name, err)
+	}
+	return becameUnhealthy
+}
+
+// handleUnhealthy 进程判定为不健康：推送事件，按 on_unhealthy 保存堆栈或重启
+func (m *livenessMonitor) handleUnhealthy(info *ProcessInfo, err error) {
+	logger := GetLogger()
+	action := m.spec.action()
+	message := fmt.Sprintf("进程 %s 存活探测连续失败 %d 次，判定为不健康（%s）: %v", info.Name, m.spec.threshold(), m.probe.Describe(), err)
+	logger.Error("%s", message)
+	processEvents.Emit(ProcessEvent{
+		Type:    EventUnhealthy,
+		Process: info.Name,
+		Message: message,
+		Level:   "error",
+		Data: map[string]any{
+			"pid":          info.Cmd.Process.Pid,
+			"failures":     m.spec.threshold(),
+			"error":        err.Error(),
+			"on_unhealthy": action,
+		},
+	})
+	if action == LivenessActionNone {
+		return
+	}
+
+	var note string
+	switch action {
+	case LivenessActionDump:
+		// 只通过 pprof 获取，不影响进程
+		note = stackNote(captureStacks(info, StackMethodPprof, 0))
+	case LivenessActionRestart:
+		var ok bool
+		if note, ok = restartUnhealthy(info); !ok {
+			return
+		}
+	}
+	// 重启后新进程有自己的探测状态，结果同时记录在日志中
+	logger.Info("进程 %s 不健康处理（%s）: %s", info.Name, action, note)
+	m.setLastAction(note)
+}
+
+// stackNote 获取堆栈结果的一行说明
+func stackNote(dump *StackDump, err error) string {
+	if err != nil {
+		return fmt.Sprintf("获取 goroutine 堆栈失败: %v", err)
+	}
+	return dump.Summary()
+}
+
+// setLastAction 记录不健康处理的结果
+func (m *livenessMonitor) setLastAction(note string) {
+	m.mu.Lock()
+	m.lastAction = fmt.Sprintf("%s %s", time.Now().Format("15:04:05"), note)
+	m.mu.Unlock()
+}
+
+// restartUnhealthy 按最新的启动参数重启不健康的进程，与工具调用一样串行执行
+// 等待执行权限期间进程已被终止、重启或已恢复健康时不再重启，返回 ok=false
+func restartUnhealthy(info *ProcessInfo) (string, bool) {
+	acquireToolSemaphore()
+	defer releaseToolSemaphore()
+
+	current, running := processManager.GetProcess(info.Name)
+	if exited, _, _ := info.ExitStatus(); !running || current != info || exited || info.stopRequested.Load() {
+		return "", false
+	}
+	if m := info.liveness.Load(); m != nil && !m.Status().Unhealthy {
+		GetLogger().Info("进程 %s 已恢复健康，跳过重启", info.Name)
+		return "", false
+	}
+
+	// 重启前保存现场：pprof 不可用时发送 SIGQUIT，进程反正要重启
+	stacks := stackNote(captureStacks(info, StackMethodAuto, defaultQuitDumpWait))
+	GetLogger().Info("进程 %s 不健康，按启动参数重启", info.Name)
+	healthy, output := relaunch(info.Name)
+	if !healthy {
+		return stacks + "；重启失败: " + firstLine(output), true
+	}
+	// 新进程的探测状态中保留重启原因，list_processes 中可以看到
+	note := fmt.Sprintf("旧进程 (PID: %d) 存活探测连续失败，已自动重启；%s", info.Cmd.Process.Pid, stacks)
+	if current, ok := processManager.GetProcess(info.Name); ok {
+		if m := current.liveness.Load(); m != nil {
+			m.setLastAction(note)
+		}
+	}
+	return stacks + "；已重启，健康检查通过", true
+}
+
+// debugURL 按进程的健康检查地址拼接调试接口 URL（如 /debug/pprof/goroutine?debug=2）
+func debugURL(info *ProcessInfo, path string) (string, error) {
+	if info.HealthCheckURL == "" {
+		return "", fmt.Errorf("进程没有 health_check_url，无法确定调试接口的地址")
+	}
+	parsed, err := url.Parse(info.HealthCheckURL)
+	if err != nil {
+		return "", fmt.Errorf("解析健康检查URL失败: %v", err)
+	}
+	return fmt.Sprintf("%s://%s%s", parsed.Scheme, parsed.Host, path), nil
+}
+
+// writeLogsFile 将诊断数据写入 logs 目录（与 request_with_logs 的响应文件相同），文件名为 前缀_时间戳+扩展名
+func writeLogsFile(prefix, ext string, data []byte) (string, error) {
+	dir, err := logsDir()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s_%03d%s", prefix, now.Format("20060102_150405"), now.UnixMilli()%1000, ext))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("写入文件失败: %v", err)
+	}
+	return path, nil
+}
+
+// LivenessStatus 存活探测的当前状态（用于 list_processes 和 request_with_logs）
+type LivenessStatus struct {
+	Probe      string
+	Interval   time.Duration
+	Threshold  int
+	Action     string
+	Failures   int
+	Unhealthy  bool
+	Since      time.Time
+	LastAction string
+	History    []LivenessCheck
+}
+
+// Status 获取存活探测的当前状态
+func (m *livenessMonitor) Status() LivenessStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return LivenessStatus{
+		Probe:      m.probe.Describe(),
+		Interval:   m.spec.interval(),
+		Threshold:  m.spec.threshold(),
+		Action:     m.spec.action(),
+		Failures:   m.failures,
+		Unhealthy:  m.unhealthy,
+		Since:      m.since,
+		LastAction: m.lastAction,
+		History:    append([]LivenessCheck(nil), m.history...),
+	}
+}
+
+// Summary 一行状态描述，如 "健康（最近 5 次: ✓✓✗✓✓）" 或 "不健康（连续失败 3 次，最后: ...）"
+func (st LivenessStatus) Summary() string {
+	var marks strings.Builder
+	for _, check := range st.History {
+		if check.OK {
+			marks.WriteString("✓")
+		} else {
+			marks.WriteString("✗")
+		}
+	}
+	var last string
+	if n := len(st.History); n > 0 && !st.History[n-1].OK {
+		last = truncateString(st.History[n-1].Error, 200)
+	}
+
+	switch {
+	case len(st.History) == 0:
+		return "等待首次探测"
+	case st.Unhealthy:
+		return fmt.Sprintf("不健康（自 %s 起连续失败 %d 次，最后: %s；最近 %d 次: %s）",
+			st.Since.Format("15:04:05"), st.Failures, last, len(st.History), marks.String())
+	case st.Failures > 0:
+		return fmt.Sprintf("探测失败（连续 %d 次，达到 %d 次判定为不健康，最后: %s；最近 %d 次: %s）",
+			st.Failures, st.Threshold, last, len(st.History), marks.String())
+	default:
+		return fmt.Sprintf("健康（最近 %d 次: %s）", len(st.History), marks.String())
+	}
+}
+
+// structured 存活探测状态的结构化形式，探测记录最新的在前
+func (st LivenessStatus) structured() map[string]any {
+	history := make([]map[string]any, 0, len(st.History))
+	for i := len(st.History) - 1; i >= 0; i-- {
+		check := st.History[i]
+		item := map[string]any{
+			"time":        check.Time.Format(time.RFC3339),
+			"ok":          check.OK,
+			"duration_ms": check.Duration.Milliseconds(),
+		}
+		if check.Error != "" {
+			item["error"] = check.Error
+		}
+		history = append(history, item)
+	}
+	result := map[string]any{
+		"probe":             st.Probe,
+		"interval_seconds":  st.Interval.Seconds(),
+		"failure_threshold": st.Threshold,
+		"on_unhealthy":      st.Action,
+		"failures":          st.Failures,
+		"unhealthy":         st.Unhealthy,
+		"checks":            history,
+	}
+	if st.Unhealthy {
+		result["unhealthy_since"] = st.Since.Format(time.RFC3339)
+	}
+	if st.LastAction != "" {
+		result["last_action"] = st.LastAction
+	}
+	return result
+}
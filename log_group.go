@@ -0,0 +1,132 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// logGroupDelay 多行日志合并窗口：一条日志之后在该时间内没有续行则视为结束
+const logGroupDelay = 50 * time.Millisecond
+
+// logFlushTimeout 查询日志前等待合并中的日志写入环形缓冲区的最长时间（见 FlushLogs）
+const logFlushTimeout = 500 * time.Millisecond
+
+// 一条合并日志的上限，超出后结束当前日志，后续续行另起一条，避免持续的缩进输出无限增长
+const (
+	maxGroupLines = 1000
+	maxGroupBytes = 256 << 10
+)
+
+// 堆栈类型，决定哪些非缩进行也算作续行
+const (
+	traceNone   = iota
+	traceGo     // Go panic / fatal error / SIGQUIT 协程转储
+	tracePython // Python Traceback
+	traceError  // Java / Node.js 等异常（如 "java.lang.IllegalStateException: ..."、"TypeError: ..."）
+)
+
+var (
+	// Go 堆栈中不带缩进的行：协程头、函数帧、created by、信号信息、寄存器转储、go run 的退出状态
+	goTraceLinePattern = regexp.MustCompile(`^(goroutine \d+ |created by |\[signal |panic: |PC=0x|exit status \d+|[^\s:]+\(.*\)$|\w+\s+0x[0-9a-f]+$)`)
+	// 异常首行：以 Exception / Error / Throwable 结尾的类名，后跟消息或在行尾
+	exceptionHeaderPattern = regexp.MustCompile(`(^|\s)([\w$]+\.)*[\w$]*(Exception|Error|Throwable)(: |$)`)
+	// Java 异常链中不带缩进的行
+	javaContinuationPattern = regexp.MustCompile(`^(Caused by: |\.\.\. \d+ more)`)
+	// 判断一条日志是否为堆栈
+	stackTracePattern = regexp.MustCompile(`(?m)^(panic: |fatal error: |goroutine \d+ |SIGQUIT: |Traceback \(most recent call last\)|\s+at [\w$.<>/]+\()`)
+)
+
+// stackGrouper 将堆栈、异常等多行输出合并为一条日志（每个流一个实例，单协程使用）
+type stackGrouper struct {
+	pending     *LogEntry // 尚未结束的日志
+	lines       int       // pending 的行数
+	kind        int       // pending 的堆栈类型
+	pythonFinal bool      // Python Traceback 已输出最后的异常行
+	split       bool      // pending 是超出上限后拆出的续行
+}
+
+// add 加入一行日志，返回因此结束的上一条日志（如果有）
+func (g *stackGrouper) add(entry LogEntry) *LogEntry {
+	if g.pending != nil && g.isContinuation(entry.Line) {
+		if g.lines < maxGroupLines && len(g.pending.Line)+len(entry.Line) < maxGroupBytes {
+			g.pending.Line += "\n" + entry.Line
+			g.lines++
+			return nil
+		}
+		// 超出上限：结束当前日志，续行作为下一条的开头，保留堆栈类型继续合并
+		kind, pythonFinal := g.kind, g.pythonFinal
+		done := g.flush()
+		g.pending, g.lines = &entry, 1
+		g.kind, g.pythonFinal, g.split = kind, pythonFinal, true
+		return done
+	}
+
+	done := g.flush()
+	g.pending, g.lines = &entry, 1
+	g.kind = classifyTrace(entry.Line)
+	g.pythonFinal = false
+	g.split = false
+	return done
+}
+
+// flush 结束当前日志并返回，没有待处理日志时返回 nil
+func (g *stackGrouper) flush() *LogEntry {
+	done := g.pending
+	g.pending = nil
+	if done != nil {
+		// 带续行的异常（如 Node.js 的 "    at f (file.js:1:2)"）和拆出的续行同样算作堆栈
+		done.StackTrace = stackTracePattern.MatchString(done.Line) || g.kind != traceNone && (g.lines > 1 || g.split)
+	}
+	return done
+}
+
+// isContinuation 判断一行是否属于当前未结束的日志
+func (g *stackGrouper) isContinuation(line string) bool {
+	// 只有堆栈和异常才合并续行，普通日志之后的缩进内容（格式化的 JSON、YAML、表格等）各自成行
+	if g.kind == traceNone {
+		return false
+	}
+	// 缩进行：Java 的 "\tat ..."、Go 的 "\t/path/file.go:12"、Python 的 "  File ..." 等
+	if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+		return true
+	}
+	if javaContinuationPattern.MatchString(line) {
+		return true
+	}
+
+	switch g.kind {
+	case traceGo:
+		return goTraceLinePattern.MatchString(line)
+	case tracePython:
+		// 异常链：继续合并下一段 Traceback
+		if strings.HasPrefix(line, "During handling of the above exception") ||
+			strings.HasPrefix(line, "The above exception was the direct cause") ||
+			strings.HasPrefix(line, "Traceback (most recent call last)") {
+			g.pythonFinal = false
+			return true
+		}
+		// Traceback 之后第一行不缩进的内容是异常本身（如 "ValueError: ..."），也属于这条日志
+		if !g.pythonFinal {
+			g.pythonFinal = true
+			return true
+		}
+	}
+	return false
+}
+
+// classifyTrace 根据首行判断堆栈类型
+func classifyTrace(line string) int {
+	switch {
+	case strings.HasPrefix(line, "panic: "),
+		strings.HasPrefix(line, "fatal error: "),
+		strings.HasPrefix(line, "SIGQUIT: "),
+		strings.HasPrefix(line, "goroutine "):
+		return traceGo
+	case strings.HasPrefix(line, "Traceback (most recent call last)"):
+		return tracePython
+	case exceptionHeaderPattern.MatchString(line):
+		return traceError
+	}
+	return traceNone
+}
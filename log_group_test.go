@@ -0,0 +1,208 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// groupLines 把每行依次交给 stackGrouper，返回合并后的日志
+func groupLines(lines []string) []LogEntry {
+	var g stackGrouper
+	var entries []LogEntry
+	for _, line := range lines {
+		if done := g.add(LogEntry{Line: line}); done != nil {
+			entries = append(entries, *done)
+		}
+	}
+	if done := g.flush(); done != nil {
+		entries = append(entries, *done)
+	}
+	return entries
+}
+
+func TestStackGrouper(t *testing.T) {
+	type group struct {
+		lines []string
+		stack bool
+	}
+	for _, tc := range []struct {
+		name  string
+		input []string
+		want  []group
+	}{
+		{
+			name:  "plain lines stay separate",
+			input: []string{"starting server", "listening on :8080", "GET /health 200"},
+			want: []group{
+				{[]string{"starting server"}, false},
+				{[]string{"listening on :8080"}, false},
+				{[]string{"GET /health 200"}, false},
+			},
+		},
+		{
+			// 普通日志之后的缩进内容不是堆栈，不合并
+			name:  "indented lines after a plain log",
+			input: []string{"config loaded:", "  port: 8080", "\tdebug: true", "ready"},
+			want: []group{
+				{[]string{"config loaded:"}, false},
+				{[]string{"  port: 8080"}, false},
+				{[]string{"\tdebug: true"}, false},
+				{[]string{"ready"}, false},
+			},
+		},
+		{
+			// 日志管道会去掉空行，panic 信息和协程堆栈连在一起
+			name: "go panic",
+			input: []string{
+				"panic: runtime error: invalid memory address or nil pointer dereference",
+				"[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x4a1b2c]",
+				"goroutine 1 [running]:",
+				"main.handler(0x0)",
+				"\t/app/main.go:12 +0x1c",
+				"created by main.main in goroutine 1",
+				"\t/app/main.go:30 +0x5d",
+				"exit status 2",
+				"restarting",
+			},
+			want: []group{
+				{[]string{
+					"panic: runtime error: invalid memory address or nil pointer dereference",
+					"[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x4a1b2c]",
+					"goroutine 1 [running]:",
+					"main.handler(0x0)",
+					"\t/app/main.go:12 +0x1c",
+					"created by main.main in goroutine 1",
+					"\t/app/main.go:30 +0x5d",
+					"exit status 2",
+				}, true},
+				{[]string{"restarting"}, false},
+			},
+		},
+		{
+			name: "java exception chain",
+			input: []string{
+				"java.lang.IllegalStateException: boom",
+				"\tat com.example.Service.run(Service.java:42)",
+				"Caused by: java.io.IOException: disk full",
+				"\tat com.example.Store.write(Store.java:7)",
+				"... 3 more",
+				"2024-01-02 INFO next request",
+			},
+			want: []group{
+				{[]string{
+					"java.lang.IllegalStateException: boom",
+					"\tat com.example.Service.run(Service.java:42)",
+					"Caused by: java.io.IOException: disk full",
+					"\tat com.example.Store.write(Store.java:7)",
+					"... 3 more",
+				}, true},
+				{[]string{"2024-01-02 INFO next request"}, false},
+			},
+		},
+		{
+			name: "node error",
+			input: []string{
+				"TypeError: Cannot read properties of undefined (reading 'id')",
+				"    at handler (/app/server.js:10:15)",
+				"    at Layer.handle (/app/node_modules/express/lib/router/layer.js:95:5)",
+				"served",
+			},
+			want: []group{
+				{[]string{
+					"TypeError: Cannot read properties of undefined (reading 'id')",
+					"    at handler (/app/server.js:10:15)",
+					"    at Layer.handle (/app/node_modules/express/lib/router/layer.js:95:5)",
+				}, true},
+				{[]string{"served"}, false},
+			},
+		},
+		{
+			// 没有续行的异常首行只是一条普通的错误日志
+			name:  "exception header without frames",
+			input: []string{"Error: connection refused", "retrying"},
+			want: []group{
+				{[]string{"Error: connection refused"}, false},
+				{[]string{"retrying"}, false},
+			},
+		},
+		{
+			name: "python traceback with chained exception",
+			input: []string{
+				"Traceback (most recent call last):",
+				`  File "app.py", line 3, in <module>`,
+				"KeyError: 'id'",
+				"During handling of the above exception, another exception occurred:",
+				"Traceback (most recent call last):",
+				`  File "app.py", line 5, in <module>`,
+				"ValueError: bad id",
+				"worker stopped",
+			},
+			want: []group{
+				{[]string{
+					"Traceback (most recent call last):",
+					`  File "app.py", line 3, in <module>`,
+					"KeyError: 'id'",
+					"During handling of the above exception, another exception occurred:",
+					"Traceback (most recent call last):",
+					`  File "app.py", line 5, in <module>`,
+					"ValueError: bad id",
+				}, true},
+				{[]string{"worker stopped"}, false},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := groupLines(tc.input)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %d entries, want %d: %+v", len(got), len(tc.want), got)
+			}
+			for i, want := range tc.want {
+				if line := strings.Join(want.lines, "\n"); got[i].Line != line {
+					t.Errorf("entry %d = %q, want %q", i, got[i].Line, line)
+				}
+				if got[i].StackTrace != want.stack {
+					t.Errorf("entry %d StackTrace = %v, want %v", i, got[i].StackTrace, want.stack)
+				}
+			}
+		})
+	}
+}
+
+func TestStackGrouperLimits(t *testing.T) {
+	frames := func(n int, frame string) []string {
+		lines := []string{"java.lang.RuntimeException: deep recursion"}
+		for i := 0; i < n; i++ {
+			lines = append(lines, frame)
+		}
+		return lines
+	}
+	for _, tc := range []struct {
+		name      string
+		input     []string
+		wantLines []int // 每条合并日志的行数
+	}{
+		{"within limits", frames(10, "\tat a.b(C.java:1)"), []int{11}},
+		{"line limit", frames(maxGroupLines+4, "\tat a.b(C.java:1)"), []int{maxGroupLines, 5}},
+		{"line limit twice", frames(2*maxGroupLines, "\tat a.b(C.java:1)"), []int{maxGroupLines, maxGroupLines, 1}},
+		{"byte limit", frames(3, "\t"+strings.Repeat("x", 100<<10)), []int{3, 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := groupLines(tc.input)
+			if len(got) != len(tc.wantLines) {
+				t.Fatalf("got %d entries, want %d", len(got), len(tc.wantLines))
+			}
+			for i, want := range tc.wantLines {
+				if lines := strings.Count(got[i].Line, "\n") + 1; lines != want {
+					t.Errorf("entry %d has %d lines, want %d", i, lines, want)
+				}
+				if len(got[i].Line) >= maxGroupBytes {
+					t.Errorf("entry %d is %d bytes, want < %d", i, len(got[i].Line), maxGroupBytes)
+				}
+				// 拆出的续行仍属于同一个堆栈
+				if !got[i].StackTrace {
+					t.Errorf("entry %d StackTrace = false, want true", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// 结构化日志解析模式（start_process 的 json_logs 参数）
+const (
+	LogFormatAuto = "auto" // 自动检测：以 { 开头的行尝试按 JSON 解析
+	LogFormatJSON = "json" // 强制：行中任意位置出现的 JSON 对象都尝试解析（适合带前缀的日志）
+	LogFormatOff  = "off"  // 不解析，保留原始行
+)
+
+// 日志级别，数值越大越严重，0 表示未知
+const (
+	LevelUnknown = iota
+	LevelTrace
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+var levelNames = map[int]string{
+	LevelTrace: "TRACE",
+	LevelDebug: "DEBUG",
+	LevelInfo:  "INFO",
+	LevelWarn:  "WARN",
+	LevelError: "ERROR",
+	LevelFatal: "FATAL",
+}
+
+// StructuredLog 从 JSON 日志行中解析出的常用字段（兼容 zap/slog/logrus 等）
+type StructuredLog struct {
+	Level  string         // 原始级别
+	Msg    string         // 消息
+	Time   string         // 日志自带的时间
+	Caller string         // 调用位置
+	Error  string         // 错误信息
+	Fields map[string]any // 其余字段
+}
+
+// 各日志库常用的字段名
+var (
+	levelKeys  = []string{"level", "lvl", "severity", "L"}
+	msgKeys    = []string{"msg", "message", "M"}
+	timeKeys   = []string{"time", "ts", "timestamp", "T", "@timestamp"}
+	callerKeys = []string{"caller", "source", "C"}
+	errorKeys  = []string{"error", "err"}
+)
+
+// 纯文本日志中 key=value 形式的级别（如 "level=error"、"severity=WARN"），可以出现在行内任意位置
+var textLevelPattern = regexp.MustCompile(`(?i)(?:^|\s)(?:level|lvl|severity)=["']?([a-z]+)`)
+
+// textLevelFields 纯文本日志只在行首的前几个字段中查找级别（时间戳、线程名、logger 名之后）
+const textLevelFields = 6
+
+// parseLogFormat 校验 json_logs 参数
+func parseLogFormat(value string) (string, error) {
+	format := strings.ToLower(strings.TrimSpace(value))
+	switch format {
+	case "":
+		return LogFormatAuto, nil
+	case LogFormatAuto, LogFormatJSON, LogFormatOff:
+		return format, nil
+	}
+	return "", fmt.Errorf("json_logs 只能是 auto、json 或 off，收到 '%s'", value)
+}
+
+// parseStructuredLog 按模式尝试将日志行解析为结构化日志，无法解析时返回 nil
+func parseStructuredLog(line, format string) *StructuredLog {
+	var candidate string
+	switch format {
+	case LogFormatOff:
+		return nil
+	case LogFormatJSON:
+		start := strings.Index(line, "{")
+		if start < 0 {
+			return nil
+		}
+		candidate = line[start:]
+	default:
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "{") {
+			return nil
+		}
+		candidate = trimmed
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(candidate), &fields); err != nil {
+		return nil
+	}
+
+	sl := &StructuredLog{
+		Level:  takeField(fields, levelKeys),
+		Msg:    takeField(fields, msgKeys),
+		Time:   takeField(fields, timeKeys),
+		Caller: takeField(fields, callerKeys),
+		Error:  takeField(fields, errorKeys),
+		Fields: fields,
+	}
+	// 没有任何常用字段的 JSON（如接口打印的响应体）不视为结构化日志
+	if sl.Level == "" && sl.Msg == "" {
+		return nil
+	}
+	return sl
+}
+
+// takeField 取出第一个存在的字段并从 fields 中删除，非字符串值转为文本
+func takeField(fields map[string]any, keys []string) string {
+	for _, key := range keys {
+		value, ok := fields[key]
+		if !ok {
+			continue
+		}
+		delete(fields, key)
+		switch v := value.(type) {
+		case string:
+			return v
+		case map[string]any:
+			// slog 的 source 字段是 {"function":..., "file":..., "line":...}
+			if file, ok := v["file"]; ok {
+				return fmt.Sprintf("%v:%v", file, v["line"])
+			}
+			data, _ := json.Marshal(v)
+			return string(data)
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// parseLevel 将各种写法的级别标准化为级别数值
+func parseLevel(level string) int {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "trace", "10":
+		return LevelTrace
+	case "debug", "dbg", "20":
+		return LevelDebug
+	case "info", "inf", "30":
+		return LevelInfo
+	case "warn", "warning", "wrn", "40":
+		return LevelWarn
+	case "error", "err", "50":
+		return LevelError
+	case "fatal", "panic", "dpanic", "critical", "crit", "60":
+		return LevelFatal
+	}
+	return LevelUnknown
+}
+
+// parseMinLevel 校验 min_level 参数，空字符串表示不过滤
+func parseMinLevel(value string) (int, error) {
+	if strings.TrimSpace(value) == "" {
+		return LevelUnknown, nil
+	}
+	level := parseLevel(value)
+	if level == LevelUnknown {
+		return LevelUnknown, fmt.Errorf("min_level 只能是 trace、debug、info、warn、error、fatal，收到 '%s'", value)
+	}
+	return level, nil
+}
+
+// detectLevel 识别日志行的级别：结构化日志取 level 字段，纯文本日志按关键字识别
+func detectLevel(line string, sl *StructuredLog) int {
+	if sl != nil && sl.Level != "" {
+		return parseLevel(sl.Level)
+	}
+	if strings.HasPrefix(line, "panic:") || strings.HasPrefix(line, "fatal error:") {
+		return LevelFatal
+	}
+	if m := textLevelPattern.FindStringSubmatch(line); m != nil {
+		if level := parseLevel(m[1]); level != LevelUnknown {
+			return level
+		}
+	}
+	for i, field := range strings.Fields(line) {
+		if i >= textLevelFields {
+			break
+		}
+		if level := fieldLevel(field); level != LevelUnknown {
+			return level
+		}
+	}
+	return LevelUnknown
+}
+
+// fieldLevel 识别作为级别标记的字段："ERROR"、"[warn]"、"(info)"、"<debug>"、"error:"、"ERROR:root:msg"
+// 小写的单词只有带括号或冒号时才算，避免 "panic recovered in info handler" 这类消息被误判
+func fieldLevel(field string) int {
+	word, marked := field, false
+	if before, _, ok := strings.Cut(word, ":"); ok {
+		word, marked = before, true
+	}
+	if len(word) >= 2 && strings.ContainsRune("[(<", rune(word[0])) && strings.ContainsRune("])>", rune(word[len(word)-1])) {
+		word, marked = word[1:len(word)-1], true
+	}
+	if word == "" || strings.TrimFunc(word, unicode.IsLetter) != "" {
+		return LevelUnknown
+	}
+	if !marked && word != strings.ToUpper(word) {
+		return LevelUnknown
+	}
+	return parseLevel(word)
+}
+
+// compactLine 将结构化日志渲染为紧凑的可读形式：级别 消息 key=value ... (caller)
+func (sl *StructuredLog) compactLine() string {
+	var builder strings.Builder
+	level := strings.ToUpper(sl.Level)
+	if name, ok := levelNames[parseLevel(sl.Level)]; ok {
+		level = name
+	}
+	if level != "" {
+		builder.WriteString(level)
+		builder.WriteString(" ")
+	}
+	builder.WriteString(sl.Msg)
+	if sl.Error != "" {
+		builder.WriteString(fmt.Sprintf(" error=%q", sl.Error))
+	}
+
+	keys := make([]string, 0, len(sl.Fields))
+	for key := range sl.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := sl.Fields[key]
+		if s, ok := value.(string); ok {
+			builder.WriteString(fmt.Sprintf(" %s=%s", key, s))
+			continue
+		}
+		data, _ := json.Marshal(value)
+		builder.WriteString(fmt.Sprintf(" %s=%s", key, data))
+	}
+
+	if sl.Caller != "" {
+		builder.WriteString(fmt.Sprintf(" (%s)", sl.Caller))
+	}
+	return builder.String()
+}
@@ -0,0 +1,99 @@
+package main
+
+import "testing"
+
+func TestDetectLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want int
+	}{
+		// JSON 日志取 level 字段
+		{"json level", `{"level":"warn","msg":"slow query"}`, LevelWarn},
+		{"json severity", `{"severity":"ERROR","message":"boom"}`, LevelError},
+		{"json numeric level", `{"level":30,"msg":"listening"}`, LevelInfo},
+		{"json unknown level", `{"level":"verbose","msg":"x"}`, LevelUnknown},
+		{"json without level", `{"msg":"ERROR happened"}`, LevelUnknown},
+
+		// logfmt 的 level=xxx 可以出现在行内任意位置
+		{"logfmt", `time=2024-01-01T00:00:00Z level=warn msg="disk almost full"`, LevelWarn},
+		{"logfmt quoted", `ts=1 lvl="dbg" msg=x`, LevelDebug},
+		{"logfmt severity", `severity=CRITICAL msg=x`, LevelFatal},
+		{"logfmt level inside value", `msg="level=error in body"`, LevelUnknown},
+		{"logfmt unknown level", `level=verbose msg=x`, LevelUnknown},
+
+		// 纯文本按行首字段中的级别标记识别
+		{"bracketed", "[ERROR] connection refused", LevelError},
+		{"bracketed lower", "2024/01/01 12:00:00 [warn] retrying", LevelWarn},
+		{"uppercase word", "2024-01-01 12:00:00.123 INFO  main.go:12 started", LevelInfo},
+		{"colon suffix", "WARNING: deprecated flag", LevelWarn},
+		{"python logging", "ERROR:root:failed to connect", LevelError},
+		{"angle brackets", "<debug> cache miss", LevelDebug},
+		{"thread before level", "12:00:00 [main] ERROR com.example.App - boom", LevelError},
+		{"go panic", "panic: runtime error: index out of range", LevelFatal},
+		{"go fatal error", "fatal error: concurrent map writes", LevelFatal},
+
+		// 消息正文中类似级别的单词不算
+		{"lowercase word in message", "panic recovered in info handler", LevelUnknown},
+		{"lowercase error in message", "request failed, see error log", LevelUnknown},
+		{"level word after prefix fields", "a b c d e f ERROR", LevelUnknown},
+		{"path with level word", "GET /api/info 200 3ms", LevelUnknown},
+		{"plain output", "Listening on :8080", LevelUnknown},
+		{"empty line", "", LevelUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sl := parseStructuredLog(tt.line, LogFormatAuto)
+			if got := detectLevel(tt.line, sl); got != tt.want {
+				t.Errorf("detectLevel(%q) = %d, want %d", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextLevelPattern(t *testing.T) {
+	tests := []struct {
+		line string
+		want string // 空字符串表示不匹配
+	}{
+		{"level=info msg=x", "info"},
+		{`msg=x LEVEL="Error"`, "Error"},
+		{"msg=x lvl='warn'", "warn"},
+		{"severity=debug", "debug"},
+		{"loglevel=info", ""},
+		{`msg="level=info"`, ""},
+		{"level=", ""},
+		{"level: info", ""},
+	}
+	for _, tt := range tests {
+		m := textLevelPattern.FindStringSubmatch(tt.line)
+		got := ""
+		if m != nil {
+			got = m[1]
+		}
+		if got != tt.want {
+			t.Errorf("textLevelPattern(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseMinLevel(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", LevelUnknown, false},
+		{"  ", LevelUnknown, false},
+		{"warn", LevelWarn, false},
+		{"WARNING", LevelWarn, false},
+		{"error", LevelError, false},
+		{"verbose", LevelUnknown, true},
+	}
+	for _, tt := range tests {
+		got, err := parseMinLevel(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseMinLevel(%q) = %d, %v; want %d, err %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
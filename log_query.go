@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 日志来源流
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// LogEntry 一条捕获的进程日志
+type LogEntry struct {
+	Seq    uint64    // 序号，按读取顺序递增
+	Time   time.Time // 从管道读取到该行的时间
+	Stream string    // 来源流（stdout/stderr）
+	Line   string    // 日志内容（原始行，堆栈等多行输出合并为一条，以换行分隔）
+
+	Level      int            // 识别出的日志级别，LevelUnknown 表示无法识别
+	Structured *StructuredLog // JSON 日志解析结果，非结构化日志为 nil
+	StackTrace bool           // 是否为堆栈（Go panic、Java 异常、Python Traceback 等）
+}
+
+// DisplayLine 返回日志的显示文本，compact 为 true 时结构化日志以紧凑形式显示
+func (e LogEntry) DisplayLine(compact bool) string {
+	if compact && e.Structured != nil {
+		return e.Structured.compactLine()
+	}
+	return e.Line
+}
+
+// LogQuery 日志查询条件，零值字段表示不过滤
+type LogQuery struct {
+	Tail           int            // 只返回最后 N 条
+	Since          time.Time      // 起始时间（包含）
+	Until          time.Time      // 结束时间（包含）
+	Include        *regexp.Regexp // 只保留匹配的行
+	Exclude        *regexp.Regexp // 排除匹配的行
+	Stream         string         // 只保留指定流（stdout/stderr），为空表示全部
+	MinLevel       int            // 只保留不低于该级别的日志，LevelUnknown 表示不过滤
+	Unleveled      bool           // 设置 MinLevel 时仍保留无法识别级别的日志
+	StackTraceOnly bool           // 只保留堆栈（Go panic、Java 异常、Python Traceback 等）
+}
+
+// QueryLogs 按条件从环形缓冲区查询日志，按时间顺序返回
+// 第二个返回值为缓冲区中最早一条日志的时间，用于提示更早的日志已被覆盖
+func (pi *ProcessInfo) QueryLogs(q LogQuery) ([]LogEntry, time.Time) {
+	pi.logMu.RLock()
+	defer pi.logMu.RUnlock()
+
+	var entries []LogEntry
+	var earliest time.Time
+
+	// 从最旧的位置开始遍历环形缓冲区（logIndex 指向下一个写入位置，即最旧的一条）
+	for i := 0; i < pi.maxLogLines; i++ {
+		entry := pi.logEntries[(pi.logIndex+i)%pi.maxLogLines]
+
+		// 如果时间戳为零值，说明这个位置还没写入过
+		if entry.Time.IsZero() {
+			continue
+		}
+		if earliest.IsZero() || entry.Time.Before(earliest) {
+			earliest = entry.Time
+		}
+
+		if !q.Since.IsZero() && entry.Time.Before(q.Since) {
+			continue
+		}
+		if !q.Until.IsZero() && entry.Time.After(q.Until) {
+			continue
+		}
+		if !matchLogStream(entry, q.Stream) {
+			continue
+		}
+		if belowMinLevel(entry.Level, q.MinLevel, q.Unleveled) {
+			continue
+		}
+		if q.StackTraceOnly && !entry.StackTrace {
+			continue
+		}
+		if q.Include != nil && !q.Include.MatchString(entry.Line) {
+			continue
+		}
+		if q.Exclude != nil && q.Exclude.MatchString(entry.Line) {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	// stdout/stderr 两个收集协程并发写入 channel，入队顺序可能与读取顺序不同，按序号恢复
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Seq < entries[j].Seq
+	})
+
+	if q.Tail > 0 && len(entries) > q.Tail {
+		entries = entries[len(entries)-q.Tail:]
+	}
+
+	return entries, earliest
+}
+
+// matchLogStream 判断日志是否属于指定流，stream 为空或 all 表示全部
+func matchLogStream(entry LogEntry, stream string) bool {
+	return stream == "" || stream == "all" || entry.Stream == stream
+}
+
+// parseLogStream 校验 stream 参数，返回标准化后的值（""、all、stdout、stderr）
+func parseLogStream(value string) (string, error) {
+	stream := strings.ToLower(strings.TrimSpace(value))
+	switch stream {
+	case "", "all", StreamStdout, StreamStderr:
+		return stream, nil
+	}
+	return "", fmt.Errorf("stream 只能是 all、stdout 或 stderr，收到 '%s'", value)
+}
+
+// LogView 返回日志时的过滤与显示方式
+type LogView struct {
+	Stream    string // ""、all、stdout、stderr；非空时每行标记时间和来源
+	MinLevel  int    // 只保留不低于该级别的日志，LevelUnknown 表示不过滤
+	Unleveled bool   // 设置 MinLevel 时仍保留无法识别级别的日志
+	Compact   bool   // 结构化日志以紧凑形式显示
+}
+
+// parseLogView 校验并构建日志显示方式（log_stream / min_level / include_unleveled / log_format 参数）
+func parseLogView(stream, minLevel string, includeUnleveled bool, format string) (LogView, error) {
+	view := LogView{Unleveled: includeUnleveled}
+	var err error
+	if view.Stream, err = parseLogStream(stream); err != nil {
+		return view, err
+	}
+	if view.MinLevel, err = parseMinLevel(minLevel); err != nil {
+		return view, err
+	}
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "raw":
+	case "compact":
+		view.Compact = true
+	default:
+		return view, fmt.Errorf("log_format 只能是 raw 或 compact，收到 '%s'", format)
+	}
+	return view, nil
+}
+
+// belowMinLevel 日志级别是否低于 min_level
+// 无法识别级别的日志（普通输出、没有级别标记的行）默认视为低于任何级别，
+// 否则 min_level=warn 仍会返回服务的全部普通输出；includeUnleveled 为 true 时保留
+func belowMinLevel(level, minLevel int, includeUnleveled bool) bool {
+	if minLevel == LevelUnknown {
+		return false
+	}
+	if level == LevelUnknown {
+		return !includeUnleveled
+	}
+	return level < minLevel
+}
+
+// renderLogs 按显示方式过滤并渲染日志
+// Stream 为空时保持原有格式（只输出日志内容），否则每行标记时间和来源
+func renderLogs(entries []LogEntry, view LogView) string {
+	var lines []string
+	for _, entry := range entries {
+		if !matchLogStream(entry, view.Stream) {
+			continue
+		}
+		if belowMinLevel(entry.Level, view.MinLevel, view.Unleveled) {
+			continue
+		}
+		if view.Stream == "" {
+			lines = append(lines, entry.DisplayLine(view.Compact))
+		} else {
+			lines = append(lines, formatLogEntry(entry, view.Compact))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseLogTime 解析日志查询的时间参数
+// 支持 RFC3339（如 2024-01-02T15:04:05+08:00）、当天时间（如 15:04:05）
+// 以及相对时长（如 5m 表示5分钟前）
+func parseLogTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	for _, layout := range []string{"15:04:05.000", "15:04:05", "15:04"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			now := time.Now()
+			return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("无法解析时间 '%s'，支持 RFC3339、'2006-01-02 15:04:05'、'15:04:05' 或相对时长（如 '5m'）", value)
+}
+
+// formatLogEntry 将日志格式化为 "[时间] [流] 内容" 的文本形式
+func formatLogEntry(entry LogEntry, compact bool) string {
+	return fmt.Sprintf("[%s] [%s] %s", entry.Time.Format("15:04:05.000"), entry.Stream, entry.DisplayLine(compact))
+}
+
+// formatLogEntries 将多条日志格式化为 "[时间] [流] 内容" 的文本形式
+func formatLogEntries(entries []LogEntry, compact bool) string {
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		lines = append(lines, formatLogEntry(entry, compact))
+	}
+	return strings.Join(lines, "\n")
+}
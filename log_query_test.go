@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func TestBelowMinLevel(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     int
+		minLevel  int
+		unleveled bool
+		want      bool
+	}{
+		{"no min level", LevelDebug, LevelUnknown, false, false},
+		{"no min level unknown line", LevelUnknown, LevelUnknown, false, false},
+		{"below", LevelInfo, LevelWarn, false, true},
+		{"equal", LevelWarn, LevelWarn, false, false},
+		{"above", LevelError, LevelWarn, false, false},
+		{"unknown dropped by default", LevelUnknown, LevelWarn, false, true},
+		{"unknown kept with include_unleveled", LevelUnknown, LevelWarn, true, false},
+		{"include_unleveled keeps filtering known levels", LevelInfo, LevelWarn, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := belowMinLevel(tt.level, tt.minLevel, tt.unleveled); got != tt.want {
+				t.Errorf("belowMinLevel(%d, %d, %v) = %v, want %v", tt.level, tt.minLevel, tt.unleveled, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderLogsMinLevel(t *testing.T) {
+	var entries []LogEntry
+	for _, line := range []string{
+		"Listening on :8080",
+		`{"level":"info","msg":"request handled"}`,
+		"level=warn msg=slow",
+		"[ERROR] connection refused",
+		"panic recovered in info handler",
+	} {
+		entries = append(entries, LogEntry{Line: line, Level: detectLevel(line, parseStructuredLog(line, LogFormatAuto))})
+	}
+
+	tests := []struct {
+		name      string
+		minLevel  string
+		unleveled bool
+		want      string
+	}{
+		{"no filter", "", false, "Listening on :8080\n" + `{"level":"info","msg":"request handled"}` + "\nlevel=warn msg=slow\n[ERROR] connection refused\npanic recovered in info handler"},
+		{"warn", "warn", false, "level=warn msg=slow\n[ERROR] connection refused"},
+		{"warn with unleveled", "warn", true, "Listening on :8080\nlevel=warn msg=slow\n[ERROR] connection refused\npanic recovered in info handler"},
+		{"error", "error", false, "[ERROR] connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view, err := parseLogView("", tt.minLevel, tt.unleveled, "")
+			if err != nil {
+				t.Fatalf("parseLogView: %v", err)
+			}
+			if got := renderLogs(entries, view); got != tt.want {
+				t.Errorf("renderLogs() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"regexp"
+	"time"
+)
+
+// 日志等待结束的原因
+const (
+	SettleQuiet   = "quiet"   // 进程已静默指定时长
+	SettlePattern = "pattern" // 出现了匹配的日志行
+	SettleMax     = "max"     // 达到最长等待时间
+	SettleExited  = "exited"  // 进程已退出
+)
+
+// SettlePolicy 请求结束后继续收集日志的策略
+type SettlePolicy struct {
+	Quiet   time.Duration  // 进程静默多久视为日志输出结束，0 表示不按静默判断
+	Max     time.Duration  // 最长等待时间
+	Pattern *regexp.Regexp // 出现匹配的日志行即结束，nil 表示不按模式判断
+}
+
+// Enabled 是否配置了等待策略
+func (p SettlePolicy) Enabled() bool {
+	return p.Quiet > 0 || p.Pattern != nil
+}
+
+// logUpdated 返回下一条日志写入环形缓冲区时会被关闭的 channel
+func (pi *ProcessInfo) logUpdated() <-chan struct{} {
+	pi.logMu.RLock()
+	defer pi.logMu.RUnlock()
+	return pi.logNotify
+}
+
+// WaitForLogSettle 等待进程日志按策略"安静"下来，返回结束原因
+// 通过 processLogs 写入环形缓冲区时的通知驱动，不做盲目 sleep
+// since 之前的日志不参与模式匹配
+func (pi *ProcessInfo) WaitForLogSettle(since time.Time, policy SettlePolicy) string {
+	logger := GetLogger()
+
+	deadline := time.NewTimer(policy.Max)
+	defer deadline.Stop()
+
+	// 静默计时器：每收到一条新日志就重置
+	var quiet <-chan time.Time
+	var quietTimer *time.Timer
+	if policy.Quiet > 0 {
+		quietTimer = time.NewTimer(policy.Quiet)
+		defer quietTimer.Stop()
+		quiet = quietTimer.C
+	}
+
+	for {
+		// 先取通知 channel 再检查，避免检查与等待之间漏掉新日志
+		updated := pi.logUpdated()
+
+		if policy.Pattern != nil {
+			if entries, _ := pi.QueryLogs(LogQuery{Since: since, Include: policy.Pattern, Tail: 1}); len(entries) > 0 {
+				logger.Debug("WaitForLogSettle: 出现匹配日志: %s", entries[0].Line)
+				return SettlePattern
+			}
+		}
+
+		select {
+		case <-updated:
+			if quietTimer != nil {
+				if !quietTimer.Stop() {
+					<-quietTimer.C
+				}
+				quietTimer.Reset(policy.Quiet)
+			}
+		case <-quiet:
+			return SettleQuiet
+		case <-deadline.C:
+			return SettleMax
+		case <-pi.waitDone:
+			// 进程已退出，但管道中剩余的日志可能仍在处理，等待 processLogs 处理完再做最后一次检查
+			select {
+			case <-pi.logDone:
+			case <-deadline.C:
+				return SettleMax
+			}
+			if policy.Pattern != nil {
+				if entries, _ := pi.QueryLogs(LogQuery{Since: since, Include: policy.Pattern, Tail: 1}); len(entries) > 0 {
+					return SettlePattern
+				}
+			}
+			return SettleExited
+		}
+	}
+}
+
+// FlushLogs 让日志收集协程立即结束合并窗口中的日志，并等待已读取的日志全部写入环形缓冲区
+// 用于查询请求末尾的日志之前，代替固定等待一个合并窗口；超时或日志已处理完毕时返回
+func (pi *ProcessInfo) FlushLogs(timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	// 收集协程已退出时 logDone 会随之关闭，此时所有日志都已写入
+	replies := make([]chan struct{}, 0, len(pi.logFlush))
+	for _, flush := range pi.logFlush {
+		reply := make(chan struct{})
+		select {
+		case flush <- reply:
+			replies = append(replies, reply)
+		case <-pi.logDone:
+			return true
+		case <-deadline.C:
+			return false
+		}
+	}
+	for _, reply := range replies {
+		select {
+		case <-reply:
+		case <-pi.logDone:
+			return true
+		case <-deadline.C:
+			return false
+		}
+	}
+
+	// logChan 按顺序处理，写入数追上发送数即表示刷新出的日志都已可查询
+	target := pi.logSent.Load()
+	for {
+		updated := pi.logUpdated()
+		if pi.logWritten.Load() >= target {
+			return true
+		}
+		select {
+		case <-updated:
+		case <-pi.logDone:
+			return true
+		case <-deadline.C:
+			return false
+		}
+	}
+}
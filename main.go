@@ -27,7 +27,7 @@ func main() {
 	server := mcp.NewServer(&mcp.Implementation{
 		Name:    "go-mcp-server",
 		Version: "1.0.0",
-	}, nil)
+	}, ResourceServerOptions())
 
 	logger.Info("MCP 服务器已创建")
 
@@ -35,6 +35,19 @@ func main() {
 	RegisterTools(server)
 	logger.Info("所有工具已注册")
 
+	// 启动时检查当前目录的项目配置，配置有误时尽早在日志中提示（start_process 时会再次加载）
+	if config, err := loadProjectConfig(configDir("")); err != nil {
+		logger.Error("%v", err)
+	} else if config != nil {
+		logger.Info("已加载项目配置 %s，服务: %v", config.Path, config.ServiceNames())
+	}
+
+	// 进程事件（启动、健康、退出、日志匹配）作为日志通知推送给客户端
+	RegisterNotifications(server)
+
+	// 进程日志和信息作为可订阅的资源（process://{name}/logs、process://{name}/info）
+	RegisterResources(server)
+
 	logger.Info("服务器准备就绪，等待连接...")
 
 	// 通过 stdio 启动服务器
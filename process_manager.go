@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -11,15 +12,23 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // 进程管理器：存储和管理运行的进程
 type ProcessManager struct {
-	processes sync.Map
+	processes   sync.Map
+	exits       sync.Map // 进程名 -> 最近一次的 *ExitRecord，进程被清理后仍保留
+	specs       sync.Map // 进程名 -> 最近一次的 LaunchSpec，进程被清理后仍保留
+	watchers    sync.Map // 进程名 -> *sourceWatcher，源码变化时自动重启
+	supervisors sync.Map // 进程名 -> *supervisor，按重启策略在意外退出后自动重启
+	stacks      sync.Map // 服务组名 -> Stack，start_stack 启动的服务组
 }
 
 type ProcessInfo struct {
@@ -31,16 +40,25 @@ type ProcessInfo struct {
 	Cancel          context.CancelFunc
 	Name            string
 	HealthCheckURL  string
-	HealthCheckPort int // 从URL中提取的端口，用于端口检查
+	HealthCheckPort int               // 从URL中提取的端口，用于端口检查
+	Spec            LaunchSpec        // 启动参数，用于按原参数重启
+	CustomEnv       map[string]string // env_files 和 env 合并后的自定义环境变量
+	EnvSources      map[string]string // 值来自 env_files 的变量 -> 文件，报告时不显示值
+	tree            *processTree      // 进程树，用于确认和终止后代进程（Unix 为进程组，Windows 为作业对象）
 
 	// 完全无锁结构：使用时间窗口捕获日志
-	logChan     chan string  // 主日志通道
-	logLines    []string     // 环形缓冲区，存储最近的日志行（带时间戳）
-	logTimes    []time.Time  // 每行的时间戳
-	logMu       sync.RWMutex // 仅保护 logLines/logTimes 的读写
-	maxLogLines int          // 最大日志行数
-	logIndex    int          // 当前写入位置（环形）
-	ExitChan    chan error   // 进程退出时发送错误（nil表示正常退出，非nil表示异常）
+	logChan     chan LogEntry        // 主日志通道（携带来源流、读取时间和序号）
+	logEntries  []LogEntry           // 环形缓冲区，存储最近的日志
+	logMu       sync.RWMutex         // 仅保护 logEntries/logIndex 的读写
+	maxLogLines int                  // 最大日志行数
+	logIndex    int                  // 当前写入位置（环形）
+	logSeq      atomic.Uint64        // 日志序号，在读取时分配，stdout/stderr 共用
+	logNotify   chan struct{}        // 每写入一条日志就关闭并替换，用于等待新日志（受 logMu 保护）
+	logFlush    []chan chan struct{} // 每个日志收集协程一个，请求立即结束合并中的日志（见 FlushLogs）
+	logSent     atomic.Uint64        // 已写入 logChan 的日志数
+	logWritten  atomic.Uint64        // 已写入环形缓冲区的日志数（在 logMu 内递增，随后关闭 logNotify）
+	logDone     chan struct{}        // processLogs 处理完所有日志后关闭
+	ExitChan    chan error           // 进程退出时发送错误（nil表示正常退出，非nil表示异常）
 
 	// 用于协调日志收集goroutine的关闭
 	logWg         sync.WaitGroup // 等待日志收集goroutine完成
@@ -50,12 +68,118 @@ type ProcessInfo struct {
 	// 进程退出同步 - 确保 Wait() 只被调用一次
 	waitDone chan struct{} // 标记Wait()已完成
 	waitOnce sync.Once     // 确保只关闭一次waitDone
+	exitErr  error         // Wait() 返回的错误，仅在 waitDone 关闭后读取
+	exitTime time.Time     // 进程退出时间，仅在 waitDone 关闭后读取
+
+	stopRequested atomic.Bool                     // 是否由 KillProcess 主动终止，用于区分意外退出
+	healthy       atomic.Bool                     // 健康检查是否通过过，重启策略只处理通过过健康检查的进程
+	liveness      atomic.Pointer[livenessMonitor] // 存活探测，健康检查通过后开始，nil 表示未开启
 }
 
 var processManager = &ProcessManager{}
 
-// StartProcess 启动进程并收集日志
-func (pm *ProcessManager) StartProcess(name, command string, args []string, env map[string]string, workDir, healthCheckURL string, timeout time.Duration) (*ProcessInfo, error) {
+// LaunchSpec 进程的启动参数
+type LaunchSpec struct {
+	Name              string
+	Command           string
+	Args              []string
+	Env               map[string]string
+	EnvFiles          []string // dotenv 文件，按顺序加载后再用 Env 覆盖，相对路径基于工作目录
+	InheritEnv        string   // 继承当前进程环境变量的方式：full（默认）、allow、none
+	InheritAllow      []string // allow 模式下继承的变量名，支持 * 通配
+	UnsetEnv          []string // 不继承的变量名，支持 * 通配
+	WorkDir           string
+	HealthCheckURL    string
+	HealthCheckMethod string
+	LogFormat         string         // 结构化日志解析模式（auto/json/off）
+	WatchPattern      *regexp.Regexp // 日志匹配时推送 log_match 事件，nil 表示不监听
+	Timeout           time.Duration  // 等待健康检查通过的超时时间
+	Readiness         *ReadinessSpec // 就绪探测方式，nil 表示按 HealthCheckURL 检查
+	Watch             *WatchConfig   // 源码监听配置，nil 表示不监听
+	Build             *BuildSpec     // 启动前执行的构建命令，nil 表示不构建
+	Restart           *RestartPolicy // 意外退出后的重启策略，nil 表示不自动重启
+	Liveness          *LivenessSpec  // 启动成功后持续执行的存活探测，nil 表示不探测
+}
+
+// clone 复制启动参数，避免与调用方共享 Args/Env
+func (s LaunchSpec) clone() LaunchSpec {
+	s.Args = append([]string(nil), s.Args...)
+	s.EnvFiles = append([]string(nil), s.EnvFiles...)
+	s.InheritAllow = append([]string(nil), s.InheritAllow...)
+	s.UnsetEnv = append([]string(nil), s.UnsetEnv...)
+	if s.Env != nil {
+		env := make(map[string]string, len(s.Env))
+		for key, value := range s.Env {
+			env[key] = value
+		}
+		s.Env = env
+	}
+	return s
+}
+
+// resolveWorkDir 计算进程的工作目录：优先使用指定的目录（相对路径基于当前目录），
+// 其次从 go -C <dir> 参数中提取，最后使用当前目录
+func resolveWorkDir(spec LaunchSpec) string {
+	cwd, _ := os.Getwd()
+	dir := spec.WorkDir
+	if dir == "" {
+		if spec.Command != "go" || len(spec.Args) < 2 || spec.Args[0] != "-C" {
+			return cwd
+		}
+		dir = spec.Args[1]
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(cwd, dir)
+}
+
+// mergeEnv 按 inherit_env 继承当前进程的环境变量，删除 unset_env 中的变量，再添加/覆盖指定的环境变量
+// 完全继承且没有需要添加或删除的变量时返回 nil（直接继承）
+func mergeEnv(spec LaunchSpec, env map[string]string) []string {
+	if len(env) == 0 && len(spec.UnsetEnv) == 0 && (spec.InheritEnv == "" || spec.InheritEnv == InheritFull) {
+		return nil
+	}
+
+	// 创建一个map来存储环境变量，方便覆盖
+	envMap := make(map[string]string)
+	for _, e := range os.Environ() {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) == 2 && inheritsEnv(spec, parts[0]) {
+			envMap[parts[0]] = parts[1]
+		}
+	}
+	for key, value := range env {
+		envMap[key] = value
+	}
+
+	// 转换回切片（排序，便于报告和比较）
+	merged := make([]string, 0, len(envMap))
+	for key, value := range envMap {
+		merged = append(merged, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// saveLaunchSpec 保存进程的启动参数，用于按原参数重启
+func (pm *ProcessManager) saveLaunchSpec(spec LaunchSpec) {
+	pm.specs.Store(spec.Name, spec.clone())
+}
+
+// GetLaunchSpec 获取进程最近一次的启动参数（进程已被 kill_process 清理也能获取）
+func (pm *ProcessManager) GetLaunchSpec(name string) (LaunchSpec, bool) {
+	val, ok := pm.specs.Load(name)
+	if !ok {
+		return LaunchSpec{}, false
+	}
+	return val.(LaunchSpec).clone(), true
+}
+
+// StartProcess 按启动参数启动进程并收集日志，启动参数会被保留，用于 restart_process 按原参数重启
+func (pm *ProcessManager) StartProcess(spec LaunchSpec) (*ProcessInfo, error) {
+	spec = spec.clone()
+	name := spec.Name
 	logger := GetLogger()
 
 	// 如果有同名的旧进程，等待它完全清理
@@ -70,103 +194,73 @@ func (pm *ProcessManager) StartProcess(name, command string, args []string, env
 		}
 		// 从管理器中移除旧进程
 		pm.processes.Delete(name)
+		oldInfo.tree.close()
 	}
 
 	// 从URL中提取端口用于健康检查
-	port, err := extractPortFromURL(healthCheckURL)
+	port, err := extractPortFromURL(spec.HealthCheckURL)
 	if err != nil {
-		logger.Info("从URL提取端口失败: %v，将使用URL健康检查", err)
+		if spec.HealthCheckURL != "" {
+			logger.Info("从URL提取端口失败: %v，将使用URL健康检查", err)
+		}
 		port = 0
 	}
 
+	// 每次启动都重新加载 env_files，修改文件后重启即可生效
+	env, envSources, err := launchEnv(spec)
+	if err != nil {
+		return nil, err
+	}
+
 	// 创建带取消功能的上下文
 	ctx, cancel := context.WithCancel(context.Background())
 
 	// 解析命令
-	cmd := exec.CommandContext(ctx, command, args...)
+	cmd := exec.CommandContext(ctx, spec.Command, spec.Args...)
 
-	// 设置进程组标志（Windows），确保 taskkill /T 能正确终止子进程
+	// 让子进程使用独立的进程组，确保终止时能连同后代进程一起终止
 	setProcessGroupID(cmd)
 
 	// 设置工作目录
-	if workDir != "" {
-		// 如果指定了工作目录，将其转换为绝对路径
-		if filepath.IsAbs(workDir) {
-			cmd.Dir = workDir
-		} else {
-			// 相对路径，基于当前工作目录
-			cwd, _ := os.Getwd()
-			cmd.Dir = filepath.Join(cwd, workDir)
-		}
-		logger.Info("进程 %s 使用工作目录: %s", name, cmd.Dir)
-	} else {
-		// 如果没有指定工作目录，尝试从 go -C 参数中提取
-		if command == "go" && len(args) >= 2 && args[0] == "-C" {
-			// go -C <dir> 命令，提取工作目录
-			extractedDir := args[1]
-			if filepath.IsAbs(extractedDir) {
-				cmd.Dir = extractedDir
-			} else {
-				cwd, _ := os.Getwd()
-				cmd.Dir = filepath.Join(cwd, extractedDir)
-			}
-			logger.Info("进程 %s 从 go -C 参数提取工作目录: %s", name, cmd.Dir)
-		} else {
-			// 使用当前目录
-			cmd.Dir, _ = os.Getwd()
-			logger.Info("进程 %s 使用当前工作目录: %s", name, cmd.Dir)
-		}
-	}
+	cmd.Dir = resolveWorkDir(spec)
+	logger.Info("进程 %s 使用工作目录: %s", name, cmd.Dir)
 
 	// 记录原始参数
-	logger.Debug("原始参数: %s %v", command, args)
+	logger.Debug("原始参数: %s %v", spec.Command, spec.Args)
 
-	// 设置环境变量（合并现有环境变量和新环境变量）
+	// 设置环境变量（按 inherit_env 继承现有环境变量，再合并新环境变量）
 	// 注意：必须正确处理，否则可能导致进程启动卡死
-	if len(env) > 0 {
-		currentEnv := os.Environ()
-		// 创建一个map来存储环境变量，方便覆盖
-		envMap := make(map[string]string)
-		for _, e := range currentEnv {
-			parts := strings.SplitN(e, "=", 2)
-			if len(parts) == 2 {
-				envMap[parts[0]] = parts[1]
-			}
-		}
-
-		// 添加/覆盖用户指定的环境变量
-		for key, value := range env {
-			envMap[key] = value
+	if cmd.Env = mergeEnv(spec, env); cmd.Env != nil {
+		// 只记录 env 参数中的值，env_files 中通常有密钥，不写入日志
+		for key, value := range spec.Env {
 			logger.Debug("设置环境变量: %s=%s", key, value)
 		}
-
-		// 转换回切片
-		cmd.Env = make([]string, 0, len(envMap))
-		for key, value := range envMap {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
-		}
-		logger.Info("进程 %s 设置环境变量: %d 个自定义 + %d 个系统 = %d 个总计",
-			name, len(env), len(currentEnv), len(cmd.Env))
+		logger.Info("进程 %s 设置环境变量: %d 个自定义（env_files %d 个文件），继承方式 %s，共 %d 个", name, len(env), len(spec.EnvFiles), inheritMode(spec), len(cmd.Env))
 	}
 
 	// 创建管道
-	stdoutPipe, err := cmd.StdoutPipe()
+	// 使用 os.Pipe 而不是 cmd.StdoutPipe：后者在 Wait() 返回时会立即关闭读取端，
+	// 导致进程退出前最后输出的日志（如 panic 堆栈）还没读取就丢失
+	stdoutPipe, stdoutWriter, err := os.Pipe()
 	if err != nil {
 		cancel()
 		return nil, fmt.Errorf("创建 stdout 管道失败: %w", err)
 	}
 
-	stderrPipe, err := cmd.StderrPipe()
+	stderrPipe, stderrWriter, err := os.Pipe()
 	if err != nil {
 		cancel()
 		stdoutPipe.Close()
+		stdoutWriter.Close()
 		return nil, fmt.Errorf("创建 stderr 管道失败: %w", err)
 	}
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
 
 	// 创建日志缓冲区和环形日志缓冲区
 	logBuffer := &bytes.Buffer{}
-	logChan := make(chan string, 1000) // 带缓冲的通道，避免阻塞
-	maxLogLines := 1000                // 保留最近1000行日志
+	logChan := make(chan LogEntry, 1000) // 带缓冲的通道，避免阻塞
+	maxLogLines := 1000                  // 保留最近1000行日志
 
 	processInfo := &ProcessInfo{
 		Cmd:             cmd,
@@ -176,11 +270,15 @@ func (pm *ProcessManager) StartProcess(name, command string, args []string, env
 		StartTime:       time.Now(),
 		Cancel:          cancel,
 		Name:            name,
-		HealthCheckURL:  healthCheckURL,
+		HealthCheckURL:  spec.HealthCheckURL,
 		HealthCheckPort: port,
+		Spec:            spec,
+		CustomEnv:       env,
+		EnvSources:      envSources,
 		logChan:         logChan,
-		logLines:        make([]string, maxLogLines),
-		logTimes:        make([]time.Time, maxLogLines),
+		logEntries:      make([]LogEntry, maxLogLines),
+		logNotify:       make(chan struct{}),
+		logDone:         make(chan struct{}),
 		maxLogLines:     maxLogLines,
 		logIndex:        0,
 		ExitChan:        make(chan error, 1), // 带缓冲，确保goroutine不会阻塞
@@ -189,7 +287,13 @@ func (pm *ProcessManager) StartProcess(name, command string, args []string, env
 	}
 
 	// 启动进程
-	if err := cmd.Start(); err != nil {
+	err = cmd.Start()
+
+	// 子进程已继承写入端，父进程关闭自己的副本，这样子进程退出后读取端才能收到 EOF
+	stdoutWriter.Close()
+	stderrWriter.Close()
+
+	if err != nil {
 		cancel()
 		stdoutPipe.Close()
 		stderrPipe.Close()
@@ -197,22 +301,43 @@ func (pm *ProcessManager) StartProcess(name, command string, args []string, env
 
 		// 提供更详细的错误信息
 		if strings.Contains(err.Error(), "executable file not found") {
-			return nil, fmt.Errorf("启动进程失败: %v\n\n提示：找不到可执行文件 '%s'\n请确保：\n1. 该命令已安装并在 PATH 中\n2. 或使用完整路径（如 'C:\\Go\\bin\\go.exe'）\n\n常见示例：\n- Go: command='go', args=['run', '.']\n- Python: command='python', args=['app.py']\n- Node: command='node', args=['app.js']", err, command)
+			return nil, fmt.Errorf("启动进程失败: %v\n\n提示：找不到可执行文件 '%s'\n请确保：\n1. 该命令已安装并在 PATH 中\n2. 或使用完整路径（如 'C:\\Go\\bin\\go.exe'）\n\n常见示例：\n- Go: command='go', args=['run', '.']\n- Python: command='python', args=['app.py']\n- Node: command='node', args=['app.js']", err, spec.Command)
 		}
 		return nil, fmt.Errorf("启动进程失败: %w", err)
 	}
 
-	// 存储进程信息
+	// 在 Wait() 之前记录进程树，后代进程退出前都能被找到
+	processInfo.tree = newProcessTree(cmd)
+
+	// 存储进程信息，并保留启动参数（进程被清理后仍可按原参数重启）
 	pm.processes.Store(name, processInfo)
+	pm.saveLaunchSpec(spec)
+
+	// 同名进程的旧退出记录已被新实例取代，不再在后续工具调用中提示
+	if record, ok := pm.GetExitRecord(name); ok {
+		record.reported.Store(true)
+	}
 
 	logger.Info("进程 %s 已启动 (PID: %d)", name, cmd.Process.Pid)
+	processEvents.Emit(ProcessEvent{
+		Type:    EventStarted,
+		Process: name,
+		Message: fmt.Sprintf("进程 %s 已启动 (PID: %d)", name, cmd.Process.Pid),
+		Level:   "info",
+		Data: map[string]any{
+			"pid":     cmd.Process.Pid,
+			"command": strings.Join(cmd.Args, " "),
+		},
+	})
 
 	// 标记有2个日志收集协程需要等待
 	processInfo.logWg.Add(2)
 
 	// 启动日志收集协程（stdout 和 stderr 都写入同一个 channel）
-	go pm.collectStdout(processInfo)
-	go pm.collectStderr(processInfo)
+	stdoutFlush, stderrFlush := make(chan chan struct{}), make(chan chan struct{})
+	processInfo.logFlush = []chan chan struct{}{stdoutFlush, stderrFlush}
+	go pm.collectStream(processInfo, stdoutPipe, StreamStdout, stdoutFlush)
+	go pm.collectStream(processInfo, stderrPipe, StreamStderr, stderrFlush)
 
 	// 启动无锁日志处理协程
 	go pm.processLogs(processInfo)
@@ -226,91 +351,147 @@ func (pm *ProcessManager) StartProcess(name, command string, args []string, env
 // processLogs 无锁日志处理器：从 channel 读取日志并处理
 func (pm *ProcessManager) processLogs(info *ProcessInfo) {
 	logger := GetLogger()
+	defer close(info.logDone)
+
+	for entry := range info.logChan {
+		line := entry.Line
+
+		// 解析结构化日志并识别级别（单一消费者，不影响管道读取）
+		entry.Structured = parseStructuredLog(line, info.Spec.LogFormat)
+		entry.Level = detectLevel(line, entry.Structured)
+		if entry.StackTrace && entry.Level < LevelError {
+			entry.Level = LevelError
+		}
 
-	for line := range info.logChan {
 		// 写入主日志 buffer（无锁，单一写入者）
 		info.LogBuffer.WriteString(line + "\n")
 
 		// 写入环形缓冲区（使用写锁，快速操作）
 		info.logMu.Lock()
-		info.logLines[info.logIndex] = line
-		info.logTimes[info.logIndex] = time.Now()
+		info.logEntries[info.logIndex] = entry
 		info.logIndex = (info.logIndex + 1) % info.maxLogLines
+		info.logWritten.Add(1)
+		close(info.logNotify) // 唤醒等待新日志的协程
+		info.logNotify = make(chan struct{})
 		info.logMu.Unlock()
 
 		// 输出到日志文件
 		logger.ProcessLog(info.Name, line)
+
+		if info.Spec.WatchPattern != nil && info.Spec.WatchPattern.MatchString(line) {
+			processEvents.Emit(logMatchEvent(info, entry))
+		}
+	}
+}
+
+// newLogEntry 在读取日志时创建日志条目，记录读取时间并分配序号
+// 时间戳在读取时而不是 processLogs 出队时记录，避免 channel 积压导致时间偏移
+func (info *ProcessInfo) newLogEntry(stream, line string) LogEntry {
+	return LogEntry{
+		Seq:    info.logSeq.Add(1),
+		Time:   time.Now(),
+		Stream: stream,
+		Line:   line,
 	}
 }
 
-// collectStdout 收集 stdout 日志到 channel
-func (pm *ProcessManager) collectStdout(info *ProcessInfo) {
+// collectStream 收集 stdout/stderr 日志到 channel
+// 堆栈、异常等多行输出会被合并为一条日志，在 logGroupDelay 内没有续行时结束；
+// 收到 flush 请求时立即处理已读取的行并结束合并中的日志，处理完后关闭请求中的 channel
+func (pm *ProcessManager) collectStream(info *ProcessInfo, pipe io.Reader, stream string, flush <-chan chan struct{}) {
 	defer info.logWg.Done()
 
-	scanner := bufio.NewReader(info.StdoutPipe)
-	for {
-		line, err := scanner.ReadString('\n')
-		if err != nil {
-			if err != io.EOF {
-				GetLogger().Error("读取 stdout 错误: %v", err)
-			}
-			break
-		}
-		// 去掉换行符
-		line = strings.TrimSuffix(line, "\n")
-		line = strings.TrimSuffix(line, "\r")
-		if line != "" {
-			// 使用非阻塞写入，如果channel已满或已关闭则跳过
-			info.logChanMu.Lock()
-			closed := info.logChanClosed
-			info.logChanMu.Unlock()
-			if closed {
+	// 读取协程：逐行读取管道，读取时记录时间和序号
+	lines := make(chan LogEntry, 100)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewReader(pipe)
+		for {
+			line, err := scanner.ReadString('\n')
+			if err != nil {
+				if err != io.EOF {
+					GetLogger().Error("读取 %s 错误: %v", stream, err)
+				}
 				break
 			}
-			select {
-			case info.logChan <- line:
-			default:
-				// channel满了，丢弃日志避免阻塞
-				GetLogger().Debug("日志channel已满，丢弃stdout日志")
+			// 去掉换行符
+			line = strings.TrimSuffix(line, "\n")
+			line = strings.TrimSuffix(line, "\r")
+			if line != "" {
+				lines <- info.newLogEntry(stream, line)
 			}
 		}
-	}
-}
+	}()
 
-// collectStderr 收集 stderr 日志到 channel
-func (pm *ProcessManager) collectStderr(info *ProcessInfo) {
-	defer info.logWg.Done()
+	grouper := &stackGrouper{}
+	flushTimer := time.NewTimer(logGroupDelay)
+	flushTimer.Stop()
+	defer flushTimer.Stop()
+
+	// emit 输出一条已结束的日志，channel 已关闭时返回 false
+	emit := func(done *LogEntry) bool {
+		return done == nil || info.sendLog(*done)
+	}
 
-	scanner := bufio.NewReader(info.StderrPipe)
 	for {
-		line, err := scanner.ReadString('\n')
-		if err != nil {
-			if err != io.EOF {
-				GetLogger().Error("读取 stderr 错误: %v", err)
+		select {
+		case entry, ok := <-lines:
+			if !ok {
+				// 管道已关闭，输出最后一条未结束的日志
+				emit(grouper.flush())
+				return
 			}
-			break
-		}
-		// 去掉换行符
-		line = strings.TrimSuffix(line, "\n")
-		line = strings.TrimSuffix(line, "\r")
-		if line != "" {
-			// 使用非阻塞写入，如果channel已满或已关闭则跳过
-			info.logChanMu.Lock()
-			closed := info.logChanClosed
-			info.logChanMu.Unlock()
-			if closed {
-				break
+			if !emit(grouper.add(entry)) {
+				return
 			}
-			select {
-			case info.logChan <- line:
-			default:
-				// channel满了，丢弃日志避免阻塞
-				GetLogger().Debug("日志channel已满，丢弃stderr日志")
+			flushTimer.Reset(logGroupDelay)
+		case <-flushTimer.C:
+			if !emit(grouper.flush()) {
+				return
+			}
+		case reply := <-flush:
+			// 先处理已读取但还在 lines 中的行，再结束合并中的日志
+			open := true
+		drain:
+			for open {
+				select {
+				case entry, ok := <-lines:
+					if open = ok; ok && !emit(grouper.add(entry)) {
+						close(reply)
+						return
+					}
+				default:
+					break drain
+				}
+			}
+			flushTimer.Stop()
+			sent := emit(grouper.flush())
+			close(reply)
+			if !open || !sent {
+				return
 			}
 		}
 	}
 }
 
+// sendLog 将日志写入 channel，channel 已关闭时返回 false
+func (info *ProcessInfo) sendLog(entry LogEntry) bool {
+	// 使用非阻塞写入，如果channel已满或已关闭则跳过
+	info.logChanMu.Lock()
+	defer info.logChanMu.Unlock()
+	if info.logChanClosed {
+		return false
+	}
+	select {
+	case info.logChan <- entry:
+		info.logSent.Add(1)
+	default:
+		// channel满了，丢弃日志避免阻塞
+		GetLogger().Debug("日志channel已满，丢弃%s日志", entry.Stream)
+	}
+	return true
+}
+
 // monitorProcessExit 监控进程退出，如果进程异常退出则通知
 func (pm *ProcessManager) monitorProcessExit(info *ProcessInfo) {
 	logger := GetLogger()
@@ -318,20 +499,14 @@ func (pm *ProcessManager) monitorProcessExit(info *ProcessInfo) {
 	// 等待进程退出（Wait() 只能调用一次）
 	err := info.Cmd.Wait()
 
-	// 标记 Wait() 已完成，通知其他等待者
+	// 标记 Wait() 已完成，通知其他等待者（先记录退出信息，关闭 waitDone 后即可安全读取）
 	info.waitOnce.Do(func() {
+		info.exitErr = err
+		info.exitTime = time.Now()
 		close(info.waitDone)
 	})
 
-	// 进程退出后，关闭管道以让日志收集协程退出
-	if info.StdoutPipe != nil {
-		info.StdoutPipe.Close()
-	}
-	if info.StderrPipe != nil {
-		info.StderrPipe.Close()
-	}
-
-	// 等待日志收集协程完成（带超时）
+	// 等待日志收集协程读完管道中剩余的日志（进程退出后写入端关闭，读取端会收到 EOF）
 	done := make(chan struct{})
 	go func() {
 		info.logWg.Wait()
@@ -341,8 +516,19 @@ func (pm *ProcessManager) monitorProcessExit(info *ProcessInfo) {
 	select {
 	case <-done:
 		// 日志收集协程已完成
-	case <-time.After(2 * time.Second):
-		logger.Info("等待日志收集协程超时，继续处理")
+	case <-time.After(1 * time.Second):
+		// 子进程（如 go run 编译出的程序）仍持有管道，关闭管道以让日志收集协程退出
+		if info.StdoutPipe != nil {
+			info.StdoutPipe.Close()
+		}
+		if info.StderrPipe != nil {
+			info.StderrPipe.Close()
+		}
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			logger.Info("等待日志收集协程超时，继续处理")
+		}
 	}
 
 	// 安全关闭日志channel
@@ -353,6 +539,16 @@ func (pm *ProcessManager) monitorProcessExit(info *ProcessInfo) {
 	}
 	info.logChanMu.Unlock()
 
+	// 等待剩余日志写入环形缓冲区后记录退出信息，确保包含退出前的最后日志
+	select {
+	case <-info.logDone:
+	case <-time.After(1 * time.Second):
+		logger.Info("等待日志处理完成超时，退出记录可能缺少最后的日志")
+	}
+	record := pm.recordExit(info, err)
+	processEvents.Emit(exitEvent(record))
+	pm.superviseExit(info, record)
+
 	// 检查进程是否异常退出（非0退出码）
 	if err != nil {
 		logger.Error("进程 %s (PID: %d) 异常退出: %v", info.Name, info.Cmd.Process.Pid, err)
@@ -381,6 +577,29 @@ func (pm *ProcessManager) GetProcess(name string) (*ProcessInfo, bool) {
 	return val.(*ProcessInfo), true
 }
 
+// ListProcesses 返回管理器中的所有进程，按名称排序
+func (pm *ProcessManager) ListProcesses() []*ProcessInfo {
+	var list []*ProcessInfo
+	pm.processes.Range(func(key, value any) bool {
+		list = append(list, value.(*ProcessInfo))
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// ExitStatus 返回进程是否已退出（Wait() 已完成）、退出错误及退出时间
+func (pi *ProcessInfo) ExitStatus() (exited bool, exitErr error, exitTime time.Time) {
+	select {
+	case <-pi.waitDone:
+		return true, pi.exitErr, pi.exitTime
+	default:
+		return false, nil, time.Time{}
+	}
+}
+
 // FindProcessByURL 根据 URL 自动查找匹配的进程
 // 通过 host:端口匹配进程的 HealthCheckURL 或 HealthCheckPort
 // 支持 localhost/127.0.0.1/::1 等价匹配
@@ -491,7 +710,7 @@ func (pi *ProcessInfo) StartRequestLog() time.Time {
 }
 
 // GetRequestLog 获取请求期间的日志（使用时间窗口，完全无死锁）
-func (pi *ProcessInfo) GetRequestLog(startTime time.Time) string {
+func (pi *ProcessInfo) GetRequestLog(startTime time.Time) []LogEntry {
 	// 使用读锁，允许多个并发读取
 	pi.logMu.RLock()
 	defer pi.logMu.RUnlock()
@@ -501,95 +720,127 @@ func (pi *ProcessInfo) GetRequestLog(startTime time.Time) string {
 	logger := GetLogger()
 	logger.Debug("GetRequestLog: 开始时间=%v, 结束时间=%v", startTime.Format("15:04:05.000"), endTime.Format("15:04:05.000"))
 
-	var logs []string
-	matchCount := 0
+	var logs []LogEntry
 	// 遍历环形缓冲区
 	for i := 0; i < pi.maxLogLines; i++ {
 		idx := (pi.logIndex - 1 - i + pi.maxLogLines) % pi.maxLogLines
-		logTime := pi.logTimes[idx]
+		entry := pi.logEntries[idx]
 
 		// 如果时间戳为零值，说明这个位置还没写入过
-		if logTime.IsZero() {
+		if entry.Time.IsZero() {
 			continue
 		}
 
 		// 检查是否在时间窗口内（扩大窗口：请求前1秒到请求后500ms）
-		if logTime.After(startTime.Add(-1*time.Second)) && logTime.Before(endTime) {
-			logs = append([]string{pi.logLines[idx]}, logs...) // 保持时间顺序
-			matchCount++
+		if entry.Time.After(startTime.Add(-1*time.Second)) && entry.Time.Before(endTime) {
+			logs = append(logs, entry)
 		}
 
 		// 如果日志时间早于开始时间太多，停止遍历
-		if logTime.Before(startTime.Add(-2 * time.Second)) {
+		if entry.Time.Before(startTime.Add(-2 * time.Second)) {
 			break
 		}
 	}
 
-	result := strings.Join(logs, "\n")
-	logger.Debug("GetRequestLog: 找到 %d 条匹配日志，总长度 %d", matchCount, len(result))
-	return result
+	// 倒序遍历得到的结果，按序号恢复时间顺序
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].Seq < logs[j].Seq
+	})
+
+	logger.Debug("GetRequestLog: 找到 %d 条匹配日志", len(logs))
+	return logs
+}
+
+// GetRequestLogByID 获取包含指定请求ID的日志（请求开始之后捕获的）
+func (pi *ProcessInfo) GetRequestLogByID(requestID string, startTime time.Time) []LogEntry {
+	entries, _ := pi.QueryLogs(LogQuery{
+		Since:   startTime,
+		Include: regexp.MustCompile(regexp.QuoteMeta(requestID)),
+	})
+	GetLogger().Debug("GetRequestLogByID: 请求ID=%s, 找到 %d 条匹配日志", requestID, len(entries))
+	return entries
+}
+
+// 进程终止阶段：KillProcess 返回进程在哪个阶段结束
+const (
+	StopAlreadyExited = "already_exited" // 终止前进程已退出
+	StopGraceful      = "graceful"       // 收到 SIGTERM / CTRL_BREAK 后在宽限期内退出
+	StopForced        = "forced"         // 宽限期内未退出，被强制终止
+	StopUnconfirmed   = "unconfirmed"    // 强制终止后仍未确认退出
+)
+
+// DefaultStopGrace 默认的优雅退出宽限期
+const DefaultStopGrace = 5 * time.Second
+
+// StopResult 终止进程的结果
+type StopResult struct {
+	Stage   string        // 进程结束的阶段
+	Grace   time.Duration // 使用的宽限期
+	Elapsed time.Duration // 从开始终止到进程结束的耗时
 }
 
-// KillProcess 终止进程
-func (pm *ProcessManager) KillProcess(name string) error {
+// Describe 终止结果的文字描述
+func (r StopResult) Describe() string {
+	switch r.Stage {
+	case StopAlreadyExited:
+		return "进程在终止前已退出"
+	case StopGraceful:
+		return fmt.Sprintf("进程收到 %s 后优雅退出（耗时 %v）", gracefulSignalName, r.Elapsed.Round(time.Millisecond))
+	case StopForced:
+		if r.Grace <= 0 {
+			return fmt.Sprintf("进程已被强制终止（耗时 %v）", r.Elapsed.Round(time.Millisecond))
+		}
+		return fmt.Sprintf("进程在 %v 宽限期内未退出，已被强制终止（耗时 %v）", r.Grace, r.Elapsed.Round(time.Millisecond))
+	}
+	return "已强制终止，但未能确认进程及其后代进程全部退出"
+}
+
+// KillProcess 终止进程：先发送 SIGTERM（Windows 为 CTRL_BREAK）让进程执行退出逻辑，
+// 宽限期内未退出再强制终止整个进程树。grace 为 0 时直接强制终止
+func (pm *ProcessManager) KillProcess(name string, grace time.Duration) (StopResult, error) {
 	logger := GetLogger()
 
 	val, ok := pm.processes.Load(name)
 	if !ok {
-		return fmt.Errorf("进程不存在: %s", name)
+		return StopResult{}, fmt.Errorf("进程不存在: %s", name)
 	}
 
 	info := val.(*ProcessInfo)
+	result := StopResult{Stage: StopAlreadyExited, Grace: grace}
+	begin := time.Now()
 
 	pid := info.Cmd.Process.Pid
-	logger.Info("正在终止进程 %s (PID: %d, HealthCheckPort=%d)...", name, pid, info.HealthCheckPort)
-
-	// 取消上下文
-	info.Cancel()
-
-	// 终止进程 - 在Windows上使用taskkill命令，更可靠
-	if info.Cmd.Process != nil {
-		if strings.Contains(strings.ToLower(os.Getenv("OS")), "windows") {
-			// Windows: 使用taskkill命令强制终止进程及其子进程（带超时）
-			killCtx, killCancel := context.WithTimeout(context.Background(), 5*time.Second)
-			killCmd := exec.CommandContext(killCtx, "taskkill", "/F", "/T", "/PID", strconv.Itoa(pid))
-			output, err := killCmd.CombinedOutput()
-			killCancel()
-			if err != nil {
-				logger.Error("使用taskkill终止进程 %s (PID: %d) 失败: %v, 输出: %s", name, pid, err, string(output))
-
-				// 如果 taskkill 失败（进程已退出），尝试通过端口终止子进程
-				// 这对于 `go run` 等会创建子进程的命令特别有用
-				if info.HealthCheckPort > 0 {
-					logger.Info("进程可能已退出，尝试终止端口 %d 的子进程...", info.HealthCheckPort)
-					if portErr := killProcessByPort(info.HealthCheckPort); portErr != nil {
-						logger.Error("终止端口 %d 的进程失败: %v", info.HealthCheckPort, portErr)
-					} else {
-						logger.Info("成功终止端口 %d 的进程", info.HealthCheckPort)
-					}
-				}
-			} else {
-				logger.Info("使用taskkill成功终止进程 %s (PID: %d)", name, pid)
-			}
-		} else {
-			// Unix/Linux: 使用Process.Kill()
-			if err := info.Cmd.Process.Kill(); err != nil {
-				logger.Error("终止进程 %s 失败: %v", name, err)
-			} else {
-				logger.Info("成功终止进程 %s (PID: %d)", name, pid)
+	logger.Info("正在终止进程 %s (PID: %d, HealthCheckPort=%d, 宽限期=%v)...", name, pid, info.HealthCheckPort, grace)
+
+	// 标记为主动终止，退出记录不会作为意外退出提示
+	info.stopRequested.Store(true)
+
+	// 直接子进程已退出时，进程组中可能仍有后代进程（如 go run 编译出的程序），同样需要终止
+	if exited, _, _ := info.ExitStatus(); !exited || info.tree.alive() {
+		// 第一阶段：通知进程优雅退出，等待进程及其后代进程在宽限期内全部退出
+		if grace > 0 {
+			if err := terminateProcessTree(pid); err != nil && !errors.Is(err, os.ErrProcessDone) {
+				logger.Error("向进程 %s (PID: %d) 发送 %s 失败: %v，直接强制终止", name, pid, gracefulSignalName, err)
+			} else if info.waitTreeExit(grace) {
+				result.Stage = StopGraceful
+				logger.Info("进程 %s 已优雅退出", name)
 			}
 		}
 
-		// 等待 monitorProcessExit 协程中的 Wait() 完成，而不是重复调用 Wait()
-		// Wait() 只能调用一次，重复调用会导致死锁
-		select {
-		case <-info.waitDone:
-			logger.Info("进程 %s 已结束", name)
-		case <-time.After(3 * time.Second):
-			logger.Info("进程 %s 等待结束超时，继续清理", name)
+		// 第二阶段：强制终止整个进程树
+		if result.Stage != StopGraceful {
+			result.Stage = StopForced
+			if !pm.forceKill(info) {
+				result.Stage = StopUnconfirmed
+			}
 		}
 	}
 
+	// 取消上下文（进程已结束，不会再触发终止）
+	info.Cancel()
+	result.Elapsed = time.Since(begin)
+	logger.Info("进程 %s 终止结果: %s", name, result.Describe())
+
 	// 关闭管道（使用 defer 确保执行，忽略错误）
 	if info.StdoutPipe != nil {
 		info.StdoutPipe.Close()
@@ -622,25 +873,88 @@ func (pm *ProcessManager) KillProcess(name string) error {
 
 	// 从管理器中移除
 	pm.processes.Delete(name)
+	info.tree.close()
 
 	logger.Info("进程 %s 资源已清理", name)
 
-	return nil
+	return result, nil
 }
 
-// GetLogsInRange 获取指定时间段内的日志
+// forceKill 强制终止整个进程树：Unix 向进程组发送 SIGKILL，Windows 终止进程所在的作业对象
+// 返回是否确认进程及其后代进程都已退出
+func (pm *ProcessManager) forceKill(info *ProcessInfo) bool {
+	logger := GetLogger()
+	name, pid := info.Name, info.Cmd.Process.Pid
+
+	if err := info.tree.kill(); errors.Is(err, os.ErrProcessDone) {
+		logger.Info("进程组 %s (PID: %d) 已退出", name, pid)
+	} else if err != nil {
+		logger.Error("终止进程树 %s (PID: %d) 失败: %v", name, pid, err)
+
+		// 如果终止失败（进程已退出），尝试通过端口终止残留的子进程
+		// 这对于 `go run` 等会创建子进程的命令特别有用
+		if info.HealthCheckPort > 0 {
+			logger.Info("进程可能已退出，尝试终止端口 %d 的子进程...", info.HealthCheckPort)
+			if portErr := killProcessByPort(info.HealthCheckPort); portErr != nil {
+				logger.Error("终止端口 %d 的进程失败: %v", info.HealthCheckPort, portErr)
+			} else {
+				logger.Info("成功终止端口 %d 的进程", info.HealthCheckPort)
+			}
+		}
+	} else {
+		logger.Info("成功终止进程树 %s (PID: %d)", name, pid)
+	}
+
+	// 等待 monitorProcessExit 协程中的 Wait() 完成，而不是重复调用 Wait()
+	// Wait() 只能调用一次，重复调用会导致死锁
+	select {
+	case <-info.waitDone:
+		logger.Info("进程 %s 已结束", name)
+	case <-time.After(3 * time.Second):
+		logger.Info("进程 %s 等待结束超时，继续清理", name)
+		return false
+	}
+
+	// 确认所有后代进程都已退出，避免残留进程继续占用端口
+	if err := info.tree.waitExit(2 * time.Second); err != nil {
+		logger.Error("进程 %s 的后代进程未能全部终止: %v", name, err)
+		return false
+	}
+	logger.Info("进程 %s 的所有后代进程已终止", name)
+	return true
+}
+
+// waitTreeExit 等待进程及其后代进程在超时前全部退出（不发送任何信号）
+// 后代进程可能比直接子进程晚退出（如 go run 编译出的程序仍在执行退出逻辑）
+func (pi *ProcessInfo) waitTreeExit(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	select {
+	case <-pi.waitDone:
+	case <-time.After(timeout):
+		return false
+	}
+	for pi.tree.alive() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
+
+// GetLogsInRange 获取指定时间段内的日志（基于环形缓冲区中的捕获时间）
 func (pm *ProcessManager) GetLogsInRange(name string, startTime, endTime time.Time) string {
-	val, ok := pm.processes.Load(name)
+	info, ok := pm.GetProcess(name)
 	if !ok {
 		return ""
 	}
 
-	info := val.(*ProcessInfo)
-	logs := info.LogBuffer.String()
-
-	// 这里简化处理，返回所有日志
-	// 实际应用中可以添加时间戳过滤
-	return logs
+	entries, _ := info.QueryLogs(LogQuery{Since: startTime, Until: endTime})
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		lines = append(lines, entry.Line)
+	}
+	return strings.Join(lines, "\n")
 }
 
 // extractPortFromURL 从URL中提取端口号
@@ -812,32 +1126,3 @@ func waitForPortReady(port int, timeout time.Duration) error {
 		}
 	}
 }
-
-// waitForPortReadyWithExitCheck 等待端口就绪，同时监控进程退出
-func waitForPortReadyWithExitCheck(port int, timeout time.Duration, exitChan <-chan error) error {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("等待端口就绪超时")
-		case <-ticker.C:
-			// 尝试连接端口
-			conn, err := net.DialTimeout("tcp", fmt.Sprintf(":%d", port), 100*time.Millisecond)
-			if err == nil {
-				conn.Close()
-				return nil // 端口就绪
-			}
-		case exitErr := <-exitChan:
-			// 进程退出
-			if exitErr != nil {
-				return fmt.Errorf("进程异常退出: %v", exitErr)
-			}
-			return fmt.Errorf("进程已退出")
-		}
-	}
-}
@@ -3,10 +3,107 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"os"
 	"os/exec"
+	"syscall"
+	"time"
 )
 
-// 非 Windows 平台的空实现
+// setProcessGroupID 让子进程成为新进程组的组长，终止时向整个进程组发送信号
+// 这样 go run 编译出的程序、shell 启动的子进程等后代进程也会一起被终止
 func setProcessGroupID(cmd *exec.Cmd) {
-	// Unix/Mac 不需要特殊处理
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// 上下文取消时默认只终止直接子进程，改为终止整个进程组
+	cmd.Cancel = func() error {
+		return killProcessTree(cmd.Process.Pid)
+	}
+}
+
+// buildWhileRunning 是否在旧进程运行时执行构建：Unix 上覆盖运行中的可执行文件不影响旧进程，
+// 构建失败时旧进程继续运行
+const buildWhileRunning = true
+
+// gracefulSignalName 优雅退出时发送的信号
+const gracefulSignalName = "SIGTERM"
+
+// terminateProcessTree 向进程组发送 SIGTERM，通知进程及其后代进程执行退出逻辑
+func terminateProcessTree(pid int) error {
+	err := syscall.Kill(-pid, syscall.SIGTERM)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+// killProcessTree 向进程组发送 SIGKILL，终止进程及其所有后代进程
+func killProcessTree(pid int) error {
+	err := syscall.Kill(-pid, syscall.SIGKILL)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+// quitProcessTree 向进程组发送 SIGQUIT，Go 进程收到后把所有 goroutine 的堆栈打印到 stderr 并退出（退出码 2）
+// 发送给整个进程组，go run 会忽略该信号，由它编译出的程序打印堆栈
+func quitProcessTree(pid int) error {
+	err := syscall.Kill(-pid, syscall.SIGQUIT)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+// processTree 进程树：Unix 上就是以直接子进程 PID 为组ID的进程组
+// 组内还有进程时组ID不会被复用，按组ID发送信号不会误伤无关进程
+type processTree struct {
+	pid int
+}
+
+// newProcessTree 记录刚启动的进程所在的进程组（进程组已由 setProcessGroupID 在启动时创建）
+func newProcessTree(cmd *exec.Cmd) *processTree {
+	return &processTree{pid: cmd.Process.Pid}
+}
+
+// alive 进程组中是否还有存活的进程（需在组长进程被 Wait() 回收后调用）
+func (t *processTree) alive() bool {
+	// 信号 0 只检查进程组是否存在，ESRCH 表示组内已没有进程
+	return !errors.Is(syscall.Kill(-t.pid, 0), syscall.ESRCH)
+}
+
+// kill 向进程组发送 SIGKILL
+func (t *processTree) kill() error {
+	return killProcessTree(t.pid)
+}
+
+// waitExit 确认进程组中的所有进程都已退出（需在组长进程被 Wait() 回收后调用）
+// 仍有存活进程时重新发送 SIGKILL，超时后返回错误
+func (t *processTree) waitExit(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if !t.alive() {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("进程组 %d 中仍有进程存活", t.pid)
+		}
+		syscall.Kill(-t.pid, syscall.SIGKILL)
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// close Unix 上没有需要释放的资源
+func (t *processTree) close() {}
+
+// exitSignal 返回导致进程退出的信号名称，不是被信号终止时返回空字符串
+func exitSignal(state *os.ProcessState) string {
+	if state == nil {
+		return ""
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return status.Signal().String()
+	}
+	return ""
 }
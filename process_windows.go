@@ -3,8 +3,15 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"os/exec"
+	"strconv"
+	"sync"
 	"syscall"
+	"time"
+	"unsafe"
 )
 
 // Windows 特定的进程组设置，确保 taskkill /T 能正确终止子进程
@@ -13,3 +20,196 @@ func setProcessGroupID(cmd *exec.Cmd) {
 		CreationFlags: 0x00000200, // CREATE_NEW_PROCESS_GROUP
 	}
 }
+
+// buildWhileRunning 是否在旧进程运行时执行构建：Windows 上运行中的可执行文件被锁定无法覆盖，
+// 只能先停止旧进程再构建
+const buildWhileRunning = false
+
+// gracefulSignalName 优雅退出时发送的控制事件
+const gracefulSignalName = "CTRL_BREAK"
+
+var procGenerateConsoleCtrlEvent = syscall.NewLazyDLL("kernel32.dll").NewProc("GenerateConsoleCtrlEvent")
+
+// terminateProcessTree 向进程组发送 CTRL_BREAK 事件（进程以 CREATE_NEW_PROCESS_GROUP 启动，进程组ID即PID）
+// 只有与本进程共享控制台的进程才能收到，发送失败时由调用方直接强制终止
+func terminateProcessTree(pid int) error {
+	ret, _, err := procGenerateConsoleCtrlEvent.Call(syscall.CTRL_BREAK_EVENT, uintptr(pid))
+	if ret == 0 {
+		return fmt.Errorf("GenerateConsoleCtrlEvent 失败: %v", err)
+	}
+	return nil
+}
+
+// killProcessTree 使用 taskkill 强制终止进程及其子进程（带超时）
+func killProcessTree(pid int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "taskkill", "/F", "/T", "/PID", strconv.Itoa(pid)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("taskkill 失败: %v, 输出: %s", err, string(output))
+	}
+	return nil
+}
+
+// quitProcessTree Windows 没有 SIGQUIT，Go 程序收到 CTRL_BREAK 时也不会打印 goroutine 堆栈
+func quitProcessTree(pid int) error {
+	return fmt.Errorf("Windows 不支持 SIGQUIT，请让服务导入 net/http/pprof 后使用 pprof 方式")
+}
+
+// 作业对象相关的 Windows API
+var (
+	procCreateJobObjectW          = syscall.NewLazyDLL("kernel32.dll").NewProc("CreateJobObjectW")
+	procAssignProcessToJobObject  = syscall.NewLazyDLL("kernel32.dll").NewProc("AssignProcessToJobObject")
+	procTerminateJobObject        = syscall.NewLazyDLL("kernel32.dll").NewProc("TerminateJobObject")
+	procQueryInformationJobObject = syscall.NewLazyDLL("kernel32.dll").NewProc("QueryInformationJobObject")
+)
+
+const (
+	processSetQuota                     = 0x0100 // PROCESS_SET_QUOTA，加入作业对象需要
+	processQueryLimitedInformation      = 0x1000 // PROCESS_QUERY_LIMITED_INFORMATION
+	jobObjectBasicAccountingInformation = 1      // JobObjectBasicAccountingInformation
+)
+
+// jobAccountingInfo JOBOBJECT_BASIC_ACCOUNTING_INFORMATION
+type jobAccountingInfo struct {
+	TotalUserTime             int64
+	TotalKernelTime           int64
+	ThisPeriodTotalUserTime   int64
+	ThisPeriodTotalKernelTime int64
+	TotalPageFaultCount       uint32
+	TotalProcesses            uint32
+	ActiveProcesses           uint32
+	TotalTerminatedProcesses  uint32
+}
+
+// processTree 进程树：直接子进程启动后加入一个作业对象，后代进程自动加入同一个作业
+// Windows 不会重新指定孤儿进程的父进程，PID 又会被复用，按父进程ID查找后代进程可能误伤无关进程；
+// 作业对象只包含本 mcp 启动的进程，go run 退出后仍能找到并终止它编译出的程序
+type processTree struct {
+	pid       int
+	job       syscall.Handle   // 作业对象，为 0 表示未能加入（此时只能终止仍在运行的直接子进程）
+	created   syscall.Filetime // 直接子进程的创建时间，用于确认 PID 没有被复用
+	closeOnce sync.Once
+}
+
+// newProcessTree 把刚启动的进程加入新的作业对象，需在 cmd.Start() 之后、Wait() 之前调用
+// os.Process 在 Wait() 之前一直持有进程句柄，这期间 PID 不会被复用，可以安全地按 PID 打开
+// 加入作业对象之前子进程就已创建的后代进程不在作业中（go run 先编译再启动程序，不受影响）
+func newProcessTree(cmd *exec.Cmd) *processTree {
+	logger := GetLogger()
+	tree := &processTree{pid: cmd.Process.Pid}
+
+	handle, err := syscall.OpenProcess(processSetQuota|syscall.PROCESS_TERMINATE|processQueryLimitedInformation, false, uint32(tree.pid))
+	if err != nil {
+		logger.Error("打开进程 %d 失败: %v，无法加入作业对象", tree.pid, err)
+		return tree
+	}
+	defer syscall.CloseHandle(handle)
+
+	var exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(handle, &tree.created, &exit, &kernel, &user); err != nil {
+		logger.Error("获取进程 %d 的创建时间失败: %v", tree.pid, err)
+	}
+
+	job, _, err := procCreateJobObjectW.Call(0, 0)
+	if job == 0 {
+		logger.Error("创建作业对象失败: %v，进程 %d 退出后将无法终止其后代进程", err, tree.pid)
+		return tree
+	}
+	if ret, _, err := procAssignProcessToJobObject.Call(job, uintptr(handle)); ret == 0 {
+		syscall.CloseHandle(syscall.Handle(job))
+		logger.Error("进程 %d 加入作业对象失败: %v，退出后将无法终止其后代进程", tree.pid, err)
+		return tree
+	}
+	tree.job = syscall.Handle(job)
+	return tree
+}
+
+// activeProcesses 作业中仍在运行的进程数
+func (t *processTree) activeProcesses() (uint32, error) {
+	var info jobAccountingInfo
+	ret, _, err := procQueryInformationJobObject.Call(uintptr(t.job), jobObjectBasicAccountingInformation,
+		uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info), 0)
+	if ret == 0 {
+		return 0, fmt.Errorf("查询作业对象失败: %v", err)
+	}
+	return info.ActiveProcesses, nil
+}
+
+// rootRunning 直接子进程是否仍在运行：PID 对应的进程创建时间与记录的一致才算同一个进程
+func (t *processTree) rootRunning() bool {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(t.pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(handle)
+	var created, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(handle, &created, &exit, &kernel, &user); err != nil {
+		return false
+	}
+	return created == t.created
+}
+
+// alive 直接子进程退出后，作业中是否还有存活的后代进程（需在直接子进程被 Wait() 回收后调用）
+// 未加入作业对象时无法安全地确认后代进程，返回 false
+func (t *processTree) alive() bool {
+	if t.job == 0 {
+		return false
+	}
+	active, err := t.activeProcesses()
+	return err == nil && active > 0
+}
+
+// kill 强制终止进程树：有作业对象时终止整个作业，否则在确认 PID 未被复用后使用 taskkill /T
+func (t *processTree) kill() error {
+	if t.job == 0 {
+		if !t.rootRunning() {
+			return fmt.Errorf("进程 %d 已退出且未加入作业对象，无法安全定位其后代进程", t.pid)
+		}
+		return killProcessTree(t.pid)
+	}
+	if active, err := t.activeProcesses(); err == nil && active == 0 {
+		return os.ErrProcessDone
+	}
+	if ret, _, err := procTerminateJobObject.Call(uintptr(t.job), 1); ret == 0 {
+		return fmt.Errorf("终止作业对象失败: %v", err)
+	}
+	return nil
+}
+
+// waitExit 确认作业中的所有进程都已退出（需在直接子进程被 Wait() 回收后调用）
+// 仍有存活进程时重新终止作业，超时后返回错误
+func (t *processTree) waitExit(timeout time.Duration) error {
+	if t.job == 0 {
+		return nil
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		active, err := t.activeProcesses()
+		if err != nil {
+			return err
+		}
+		if active == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("进程 %d 的作业中仍有 %d 个进程存活", t.pid, active)
+		}
+		procTerminateJobObject.Call(uintptr(t.job), 1)
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// close 关闭作业对象句柄（作业中的进程不受影响）
+func (t *processTree) close() {
+	t.closeOnce.Do(func() {
+		if t.job != 0 {
+			syscall.CloseHandle(t.job)
+		}
+	})
+}
+
+// exitSignal Windows 没有信号的概念，始终返回空字符串
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
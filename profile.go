@@ -0,0 +1,614 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// profile 类型（profile_process 的 type 参数）
+const (
+	ProfileCPU  = "cpu"  // /debug/pprof/profile?seconds=N，采样期间的 CPU 耗时
+	ProfileHeap = "heap" // /debug/pprof/heap?gc=1，当前的内存分配
+)
+
+const (
+	defaultProfileSeconds = 10
+	maxProfileSeconds     = 120
+	defaultProfileTop     = 20
+	// profileSizeLimit 下载 profile 的大小上限
+	profileSizeLimit = 64 << 20
+)
+
+// ProfileResult 一次 profile 采集的结果
+type ProfileResult struct {
+	Kind        string
+	Source      string        // 请求的 URL
+	File        string        // 原始 profile 保存的文件
+	SampleType  string        // 汇总使用的样本类型，如 cpu、inuse_space
+	Unit        string        // 样本单位，如 nanoseconds、bytes
+	SampleTypes []string      // profile 中的全部样本类型
+	Duration    time.Duration // CPU profile 的采样时长
+	Total       int64
+	Entries     []ProfileEntry // 按 sort 排序的函数
+	Load        string         // 采样期间制造负载的说明
+}
+
+// ProfileEntry 一个函数的 flat（自身）和 cum（含调用的函数）值
+type ProfileEntry struct {
+	Func string
+	File string
+	Flat int64
+	Cum  int64
+}
+
+// captureProfile 请求进程的 pprof 接口采集 profile，保存原始文件并按函数汇总
+// sampleType 为空时使用 profile 的默认样本类型；loadPath 不为空时在 CPU 采样期间持续请求该路径
+func captureProfile(info *ProcessInfo, kind string, seconds int, sampleType, loadPath string) (*ProfileResult, error) {
+	path := "/debug/pprof/heap?gc=1"
+	timeout := 30 * time.Second
+	if kind == ProfileCPU {
+		path = fmt.Sprintf("/debug/pprof/profile?seconds=%d", seconds)
+		timeout += time.Duration(seconds) * time.Second
+	}
+	target, err := debugURL(info, path)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var load *profileLoad
+	if kind == ProfileCPU && loadPath != "" {
+		loadURL, err := debugURL(info, "/"+strings.TrimPrefix(loadPath, "/"))
+		if err != nil {
+			return nil, err
+		}
+		load = startProfileLoad(ctx, loadURL, time.Duration(seconds)*time.Second)
+		defer load.stop()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 %s 失败: %v", target, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, profileSizeLimit))
+	if err != nil {
+		return nil, fmt.Errorf("读取 profile 失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s 返回状态码 %d（进程可能未导入 net/http/pprof）: %s", target, resp.StatusCode, bodySnippet(data))
+	}
+
+	profile, err := parsePprof(data)
+	if err != nil {
+		return nil, fmt.Errorf("解析 profile 失败: %v", err)
+	}
+	index, err := profile.sampleIndex(sampleType)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ProfileResult{
+		Kind:       kind,
+		Source:     target,
+		SampleType: profile.SampleTypes[index].Type,
+		Unit:       profile.SampleTypes[index].Unit,
+		Duration:   time.Duration(profile.DurationNanos),
+	}
+	for _, st := range profile.SampleTypes {
+		result.SampleTypes = append(result.SampleTypes, st.Type)
+	}
+	result.Entries, result.Total = profile.summarize(index)
+	if load != nil {
+		// 采样已结束，不等待进行中的请求
+		load.stop()
+		result.Load = load.summary(loadPath)
+	}
+	if path, err := writeLogsFile(fmt.Sprintf("%s_%s", kind, info.Name), ".pb.gz", data); err != nil {
+		GetLogger().Error("保存 profile 失败: %v", err)
+	} else {
+		result.File = path
+	}
+	return result, nil
+}
+
+// profileLoad CPU 采样期间持续请求一个接口，让 profile 中有该接口的调用路径
+type profileLoad struct {
+	completed  atomic.Int64
+	failures   atomic.Int64
+	unfinished atomic.Int64
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+// startProfileLoad 在 duration 内串行请求 url，ctx 取消时提前结束
+func startProfileLoad(ctx context.Context, url string, duration time.Duration) *profileLoad {
+	ctx, cancel := context.WithCancel(ctx)
+	load := &profileLoad{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(load.done)
+		deadline := time.Now().Add(duration)
+		for time.Now().Before(deadline) && ctx.Err() == nil {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				load.failures.Add(1)
+				return
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err == nil {
+				_, err = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			switch {
+			case ctx.Err() != nil:
+				// 采样结束时仍在进行的请求不算失败
+				load.unfinished.Add(1)
+				return
+			case err != nil:
+				load.failures.Add(1)
+				time.Sleep(100 * time.Millisecond)
+			case resp.StatusCode >= 500:
+				load.failures.Add(1)
+			default:
+				load.completed.Add(1)
+			}
+		}
+	}()
+	return load
+}
+
+// stop 取消进行中的请求并等待负载结束，可重复调用
+func (l *profileLoad) stop() {
+	l.cancel()
+	<-l.done
+}
+
+// summary 负载的说明，在采样结束后调用
+func (l *profileLoad) summary(path string) string {
+	text := fmt.Sprintf("采样期间请求 %s: 完成 %d 次，失败 %d 次", path, l.completed.Load(), l.failures.Load())
+	if n := l.unfinished.Load(); n > 0 {
+		text += fmt.Sprintf("，采样结束时 %d 个请求仍未返回（单次请求耗时超过采样时长，可增大 seconds）", n)
+	}
+	return text
+}
+
+// formatValue 按单位格式化样本值
+func (r *ProfileResult) formatValue(v int64) string {
+	if v == 0 {
+		return "0"
+	}
+	switch r.Unit {
+	case "nanoseconds":
+		d := time.Duration(v)
+		switch {
+		case d >= time.Second:
+			return fmt.Sprintf("%.2fs", d.Seconds())
+		case d >= time.Millisecond:
+			return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+		default:
+			return fmt.Sprintf("%.2fµs", float64(d)/float64(time.Microsecond))
+		}
+	case "bytes":
+		switch {
+		case v >= 1<<30 || v <= -1<<30:
+			return fmt.Sprintf("%.2fGB", float64(v)/(1<<30))
+		case v >= 1<<20 || v <= -1<<20:
+			return fmt.Sprintf("%.2fMB", float64(v)/(1<<20))
+		case v >= 1<<10 || v <= -1<<10:
+			return fmt.Sprintf("%.2fKB", float64(v)/(1<<10))
+		default:
+			return fmt.Sprintf("%dB", v)
+		}
+	}
+	return fmt.Sprintf("%d", v)
+}
+
+// percent v 占总量的百分比
+func (r *ProfileResult) percent(v int64) float64 {
+	if r.Total == 0 {
+		return 0
+	}
+	return float64(v) * 100 / float64(r.Total)
+}
+
+// Report 前 top 个函数的文字报告，格式与 go tool pprof -top 相同
+func (r *ProfileResult) Report(name string, top int, sortBy string) string {
+	var builder strings.Builder
+	if r.Kind == ProfileCPU {
+		builder.WriteString(fmt.Sprintf("进程 %s 的 CPU profile（采样 %v）\n", name, r.Duration.Round(time.Millisecond)))
+	} else {
+		builder.WriteString(fmt.Sprintf("进程 %s 的内存 profile\n", name))
+	}
+	builder.WriteString(fmt.Sprintf("来源: %s\n", r.Source))
+	if r.File != "" {
+		builder.WriteString(fmt.Sprintf("原始 profile 已保存到: %s（可用 go tool pprof -top 或 -http=:8080 打开查看调用图和火焰图）\n", r.File))
+	}
+	if r.Load != "" {
+		builder.WriteString(r.Load + "\n")
+	}
+	builder.WriteString(fmt.Sprintf("样本类型: %s（%s），可选: %s\n", r.SampleType, r.Unit, strings.Join(r.SampleTypes, ", ")))
+	total := fmt.Sprintf("总计: %s", r.formatValue(r.Total))
+	if r.Kind == ProfileCPU && r.Unit == "nanoseconds" && r.Duration > 0 {
+		total += fmt.Sprintf("（采样时长的 %.1f%%，即平均占用约 %.2f 个 CPU 核）", float64(r.Total)*100/float64(r.Duration), float64(r.Total)/float64(r.Duration))
+	}
+	builder.WriteString(total + "\n")
+
+	if r.Total == 0 {
+		if r.Kind == ProfileCPU {
+			builder.WriteString("\n采样期间没有 CPU 样本，进程处于空闲状态。可以设置 load_path 在采样期间持续请求要分析的接口\n")
+		} else {
+			builder.WriteString("\n没有该类型的样本\n")
+		}
+		return builder.String()
+	}
+
+	shown := top
+	if shown > len(r.Entries) {
+		shown = len(r.Entries)
+	}
+	builder.WriteString(fmt.Sprintf("\n按 %s 排序的前 %d 个函数（共 %d 个）:\n", sortBy, shown, len(r.Entries)))
+	builder.WriteString(fmt.Sprintf("%10s %6s %6s %10s %6s  %s\n", "flat", "flat%", "sum%", "cum", "cum%", "函数"))
+	var sum int64
+	for _, entry := range r.Entries[:shown] {
+		sum += entry.Flat
+		builder.WriteString(fmt.Sprintf("%10s %5.1f%% %5.1f%% %10s %5.1f%%  %s\n",
+			r.formatValue(entry.Flat), r.percent(entry.Flat), r.percent(sum),
+			r.formatValue(entry.Cum), r.percent(entry.Cum), entry.Func))
+	}
+	return builder.String()
+}
+
+// structured profile 的结构化形式，最多 top 个函数
+func (r *ProfileResult) structured(name string, top int) map[string]any {
+	entries := make([]map[string]any, 0, top)
+	for i, entry := range r.Entries {
+		if i >= top {
+			break
+		}
+		entries = append(entries, map[string]any{
+			"func":     entry.Func,
+			"file":     entry.File,
+			"flat":     entry.Flat,
+			"flat_pct": r.percent(entry.Flat),
+			"cum":      entry.Cum,
+			"cum_pct":  r.percent(entry.Cum),
+		})
+	}
+	result := map[string]any{
+		"name":         name,
+		"type":         r.Kind,
+		"source":       r.Source,
+		"sample_type":  r.SampleType,
+		"unit":         r.Unit,
+		"sample_types": r.SampleTypes,
+		"total":        r.Total,
+		"functions":    entries,
+	}
+	if r.File != "" {
+		result["file"] = r.File
+	}
+	if r.Kind == ProfileCPU {
+		result["duration_ms"] = r.Duration.Milliseconds()
+	}
+	if r.Load != "" {
+		result["load"] = r.Load
+	}
+	return result
+}
+
+// sortProfileEntries 按 flat 或 cum 从大到小排序
+func sortProfileEntries(entries []ProfileEntry, sortBy string) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if sortBy == "cum" && a.Cum != b.Cum {
+			return a.Cum > b.Cum
+		}
+		if a.Flat != b.Flat {
+			return a.Flat > b.Flat
+		}
+		if a.Cum != b.Cum {
+			return a.Cum > b.Cum
+		}
+		return a.Func < b.Func
+	})
+}
+
+// pprofProfile pprof profile.proto 中汇总需要的部分
+type pprofProfile struct {
+	SampleTypes       []pprofValueType
+	Samples           []pprofSample
+	Locations         map[uint64][]uint64 // location id -> function id，内联时第一个是最内层的函数
+	Functions         map[uint64]pprofFunction
+	DurationNanos     int64
+	DefaultSampleType string
+}
+
+type pprofValueType struct {
+	Type string
+	Unit string
+}
+
+type pprofSample struct {
+	LocationIDs []uint64 // 第一个是叶子（正在执行的）位置
+	Values      []int64
+}
+
+type pprofFunction struct {
+	Name string
+	File string
+}
+
+// sampleIndex 样本类型的下标，name 为空时使用默认样本类型（未设置时为最后一个，与 go tool pprof 相同）
+func (p *pprofProfile) sampleIndex(name string) (int, error) {
+	if len(p.SampleTypes) == 0 {
+		return 0, fmt.Errorf("profile 中没有样本类型")
+	}
+	if name == "" {
+		name = p.DefaultSampleType
+	}
+	if name == "" {
+		return len(p.SampleTypes) - 1, nil
+	}
+	names := make([]string, len(p.SampleTypes))
+	for i, st := range p.SampleTypes {
+		if st.Type == name {
+			return i, nil
+		}
+		names[i] = st.Type
+	}
+	return 0, fmt.Errorf("profile 中没有样本类型 '%s'，可选: %s", name, strings.Join(names, ", "))
+}
+
+// summarize 按函数汇总第 index 个样本值：flat 为函数自身（栈顶）的值，cum 为函数出现在栈中的样本值之和
+func (p *pprofProfile) summarize(index int) ([]ProfileEntry, int64) {
+	byName := make(map[string]*ProfileEntry)
+	entry := func(id uint64) *ProfileEntry {
+		fn, ok := p.Functions[id]
+		if !ok {
+			fn = pprofFunction{Name: fmt.Sprintf("<未知函数 %d>", id)}
+		}
+		e, ok := byName[fn.Name]
+		if !ok {
+			e = &ProfileEntry{Func: fn.Name, File: fn.File}
+			byName[fn.Name] = e
+		}
+		return e
+	}
+
+	var total int64
+	for _, sample := range p.Samples {
+		if index >= len(sample.Values) || sample.Values[index] == 0 {
+			continue
+		}
+		v := sample.Values[index]
+		total += v
+		// 递归调用时同一个函数在栈中出现多次，cum 只计一次
+		seen := make(map[*ProfileEntry]bool)
+		for i, locationID := range sample.LocationIDs {
+			for j, functionID := range p.Locations[locationID] {
+				e := entry(functionID)
+				if i == 0 && j == 0 {
+					e.Flat += v
+				}
+				if !seen[e] {
+					seen[e] = true
+					e.Cum += v
+				}
+			}
+		}
+	}
+
+	entries := make([]ProfileEntry, 0, len(byName))
+	for _, e := range byName {
+		entries = append(entries, *e)
+	}
+	return entries, total
+}
+
+// parsePprof 解析 pprof 格式（gzip 压缩的 profile.proto）
+// 只解码汇总需要的字段：sample_type、sample、location、function、string_table、duration_nanos、default_sample_type
+func parsePprof(data []byte) (*pprofProfile, error) {
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(io.LimitReader(reader, 4*profileSizeLimit)); err != nil {
+			return nil, fmt.Errorf("解压失败: %v", err)
+		}
+	}
+
+	// 字符串在 string_table 中，可能出现在引用它的字段之后，先记录下标最后统一解析
+	type rawValueType struct{ typ, unit int64 }
+	type rawFunction struct{ name, file int64 }
+	var (
+		strs          []string
+		sampleTypes   []rawValueType
+		functions     = make(map[uint64]rawFunction)
+		defaultSample int64
+	)
+	p := &pprofProfile{Locations: make(map[uint64][]uint64)}
+
+	err := walkProto(data, func(field int, wire int, value uint64, payload []byte) error {
+		switch field {
+		case 1: // sample_type
+			var vt rawValueType
+			err := walkProto(payload, func(f, w int, v uint64, _ []byte) error {
+				switch f {
+				case 1:
+					vt.typ = int64(v)
+				case 2:
+					vt.unit = int64(v)
+				}
+				return nil
+			})
+			sampleTypes = append(sampleTypes, vt)
+			return err
+		case 2: // sample
+			var sample pprofSample
+			err := walkProto(payload, func(f, w int, v uint64, b []byte) error {
+				switch f {
+				case 1:
+					return appendUints(&sample.LocationIDs, w, v, b)
+				case 2:
+					var values []uint64
+					if err := appendUints(&values, w, v, b); err != nil {
+						return err
+					}
+					for _, value := range values {
+						sample.Values = append(sample.Values, int64(value))
+					}
+				}
+				return nil
+			})
+			p.Samples = append(p.Samples, sample)
+			return err
+		case 4: // location
+			var id uint64
+			var lines []uint64
+			err := walkProto(payload, func(f, w int, v uint64, b []byte) error {
+				switch f {
+				case 1:
+					id = v
+				case 4: // line
+					return walkProto(b, func(lf, lw int, lv uint64, _ []byte) error {
+						if lf == 1 {
+							lines = append(lines, lv)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+			p.Locations[id] = lines
+			return err
+		case 5: // function
+			var id uint64
+			var fn rawFunction
+			err := walkProto(payload, func(f, w int, v uint64, _ []byte) error {
+				switch f {
+				case 1:
+					id = v
+				case 2:
+					fn.name = int64(v)
+				case 4:
+					fn.file = int64(v)
+				}
+				return nil
+			})
+			functions[id] = fn
+			return err
+		case 6: // string_table
+			strs = append(strs, string(payload))
+		case 10: // duration_nanos
+			p.DurationNanos = int64(value)
+		case 14: // default_sample_type
+			defaultSample = int64(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	str := func(i int64) string {
+		if i < 0 || int(i) >= len(strs) {
+			return ""
+		}
+		return strs[i]
+	}
+	for _, vt := range sampleTypes {
+		p.SampleTypes = append(p.SampleTypes, pprofValueType{Type: str(vt.typ), Unit: str(vt.unit)})
+	}
+	p.Functions = make(map[uint64]pprofFunction, len(functions))
+	for id, fn := range functions {
+		p.Functions[id] = pprofFunction{Name: str(fn.name), File: str(fn.file)}
+	}
+	p.DefaultSampleType = str(defaultSample)
+	if len(p.SampleTypes) == 0 {
+		return nil, fmt.Errorf("不是 pprof 格式的 profile")
+	}
+	return p, nil
+}
+
+// errProtoTruncated protobuf 数据不完整
+var errProtoTruncated = errors.New("protobuf 数据不完整")
+
+// walkProto 依次解码 protobuf 消息的字段：varint 和定长字段通过 value 传入，length-delimited 字段通过 payload 传入
+func walkProto(data []byte, visit func(field, wire int, value uint64, payload []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		data = data[n:]
+		field, wire := int(key>>3), int(key&7)
+
+		var value uint64
+		var payload []byte
+		switch wire {
+		case 0: // varint
+			if value, n = binary.Uvarint(data); n <= 0 {
+				return errProtoTruncated
+			}
+			data = data[n:]
+		case 1: // fixed64
+			if len(data) < 8 {
+				return errProtoTruncated
+			}
+			value = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case 2: // length-delimited
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return errProtoTruncated
+			}
+			payload = data[n : n+int(length)]
+			data = data[n+int(length):]
+		case 5: // fixed32
+			if len(data) < 4 {
+				return errProtoTruncated
+			}
+			value = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			return fmt.Errorf("不支持的 protobuf 字段类型 %d", wire)
+		}
+		if err := visit(field, wire, value, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendUints 解码 repeated 整数字段，兼容 packed（length-delimited）和逐个编码两种方式
+func appendUints(dst *[]uint64, wire int, value uint64, payload []byte) error {
+	if wire != 2 {
+		*dst = append(*dst, value)
+		return nil
+	}
+	for len(payload) > 0 {
+		v, n := binary.Uvarint(payload)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		*dst = append(*dst, v)
+		payload = payload[n:]
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"runtime"
+	"runtime/pprof"
+	"testing"
+	"time"
+)
+
+// protoBuilder 测试用的 protobuf 编码
+type protoBuilder struct{ buf []byte }
+
+func (b *protoBuilder) varint(field int, v uint64) *protoBuilder {
+	b.buf = binary.AppendUvarint(b.buf, uint64(field)<<3)
+	b.buf = binary.AppendUvarint(b.buf, v)
+	return b
+}
+
+func (b *protoBuilder) bytes(field int, data []byte) *protoBuilder {
+	b.buf = binary.AppendUvarint(b.buf, uint64(field)<<3|2)
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(data)))
+	b.buf = append(b.buf, data...)
+	return b
+}
+
+func (b *protoBuilder) message(field int, m *protoBuilder) *protoBuilder {
+	return b.bytes(field, m.buf)
+}
+
+func (b *protoBuilder) packed(field int, values ...uint64) *protoBuilder {
+	var data []byte
+	for _, v := range values {
+		data = binary.AppendUvarint(data, v)
+	}
+	return b.bytes(field, data)
+}
+
+// testProfile 两个函数的 profile：main.leaf 由 main.caller 调用，main.caller 还直接消耗了一部分
+// packed 为 false 时 location_id 和 value 逐个编码
+func testProfile(packed bool) []byte {
+	p := &protoBuilder{}
+	for _, s := range []string{"", "samples", "count", "cpu", "nanoseconds", "main.leaf", "main.caller", "/app/main.go"} {
+		p.bytes(6, []byte(s))
+	}
+	p.message(1, (&protoBuilder{}).varint(1, 1).varint(2, 2))
+	p.message(1, (&protoBuilder{}).varint(1, 3).varint(2, 4))
+	sample := func(locations []uint64, values ...uint64) *protoBuilder {
+		s := &protoBuilder{}
+		if packed {
+			return s.packed(1, locations...).packed(2, values...)
+		}
+		for _, l := range locations {
+			s.varint(1, l)
+		}
+		for _, v := range values {
+			s.varint(2, v)
+		}
+		return s
+	}
+	p.message(2, sample([]uint64{1, 2}, 3, 30))
+	p.message(2, sample([]uint64{2}, 1, 10))
+	p.message(4, (&protoBuilder{}).varint(1, 1).message(4, (&protoBuilder{}).varint(1, 1).varint(2, 12)))
+	p.message(4, (&protoBuilder{}).varint(1, 2).message(4, (&protoBuilder{}).varint(1, 2).varint(2, 20)))
+	p.message(5, (&protoBuilder{}).varint(1, 1).varint(2, 5).varint(4, 7))
+	p.message(5, (&protoBuilder{}).varint(1, 2).varint(2, 6).varint(4, 7))
+	p.varint(10, uint64(time.Second))
+	return p.buf
+}
+
+func TestParsePprofEncoded(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		packed bool
+	}{
+		{"packed", true},
+		{"unpacked", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := parsePprof(testProfile(tc.packed))
+			if err != nil {
+				t.Fatalf("parsePprof: %v", err)
+			}
+			if p.DurationNanos != int64(time.Second) {
+				t.Errorf("DurationNanos = %d, want %d", p.DurationNanos, time.Second)
+			}
+			index, err := p.sampleIndex("")
+			if err != nil || p.SampleTypes[index] != (pprofValueType{Type: "cpu", Unit: "nanoseconds"}) {
+				t.Fatalf("sampleIndex(\"\") = %d, %v, want the last sample type cpu", index, err)
+			}
+			entries, total := p.summarize(index)
+			if total != 40 {
+				t.Errorf("total = %d, want 40", total)
+			}
+			want := map[string]ProfileEntry{
+				"main.leaf":   {Func: "main.leaf", File: "/app/main.go", Flat: 30, Cum: 30},
+				"main.caller": {Func: "main.caller", File: "/app/main.go", Flat: 10, Cum: 40},
+			}
+			if len(entries) != len(want) {
+				t.Fatalf("entries = %+v, want %d functions", entries, len(want))
+			}
+			for _, e := range entries {
+				if e != want[e.Func] {
+					t.Errorf("entry %s = %+v, want %+v", e.Func, e, want[e.Func])
+				}
+			}
+
+			sortProfileEntries(entries, "cum")
+			if entries[0].Func != "main.caller" {
+				t.Errorf("sort by cum: first = %s, want main.caller", entries[0].Func)
+			}
+			sortProfileEntries(entries, "flat")
+			if entries[0].Func != "main.leaf" {
+				t.Errorf("sort by flat: first = %s, want main.leaf", entries[0].Func)
+			}
+		})
+	}
+}
+
+func TestParsePprofErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated varint", []byte{0x08}},
+		{"truncated bytes", []byte{0x32, 0x05, 'a'}},
+		{"unsupported wire type", []byte{0x0b}},
+		{"bad gzip", []byte{0x1f, 0x8b, 0x00}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parsePprof(tc.data); err == nil {
+				t.Errorf("parsePprof(%x) succeeded, want error", tc.data)
+			}
+		})
+	}
+	if _, err := parsePprof([]byte{0x08}); !errors.Is(err, errProtoTruncated) {
+		t.Errorf("truncated data: err = %v, want errProtoTruncated", err)
+	}
+}
+
+func TestSampleIndex(t *testing.T) {
+	p := &pprofProfile{
+		SampleTypes:       []pprofValueType{{"alloc_objects", "count"}, {"alloc_space", "bytes"}, {"inuse_objects", "count"}, {"inuse_space", "bytes"}},
+		DefaultSampleType: "inuse_space",
+	}
+	for _, tc := range []struct {
+		name    string
+		want    int
+		wantErr bool
+	}{
+		{"", 3, false},
+		{"alloc_space", 1, false},
+		{"bogus", 0, true},
+	} {
+		got, err := p.sampleIndex(tc.name)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("sampleIndex(%q) = %d, %v, want %d (error %v)", tc.name, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+//go:noinline
+func profileBusyLoop(until time.Time) int {
+	n := 0
+	for time.Now().Before(until) {
+		for i := 0; i < 1000; i++ {
+			n += i * i
+		}
+	}
+	return n
+}
+
+func TestParsePprofCPURoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("CPU profile 需要采样一段时间")
+	}
+	var entries []ProfileEntry
+	var buf bytes.Buffer
+	// 采样是统计性的，样本太少时重试
+	for attempt := 0; attempt < 5; attempt++ {
+		buf.Reset()
+		if err := pprof.StartCPUProfile(&buf); err != nil {
+			t.Skipf("StartCPUProfile: %v", err)
+		}
+		profileBusyLoop(time.Now().Add(300 * time.Millisecond))
+		pprof.StopCPUProfile()
+
+		p, err := parsePprof(buf.Bytes())
+		if err != nil {
+			t.Fatalf("parsePprof: %v", err)
+		}
+		index, err := p.sampleIndex("")
+		if err != nil {
+			t.Fatalf("sampleIndex: %v", err)
+		}
+		if st := p.SampleTypes[index]; st.Type != "cpu" || st.Unit != "nanoseconds" {
+			t.Fatalf("default sample type = %+v, want cpu/nanoseconds", st)
+		}
+		if p.DurationNanos <= 0 {
+			t.Errorf("DurationNanos = %d, want > 0", p.DurationNanos)
+		}
+		entries, _ = p.summarize(index)
+		for _, e := range entries {
+			if e.Func == "mcp.profileBusyLoop" && e.Flat > 0 && e.Cum >= e.Flat {
+				return
+			}
+		}
+	}
+	t.Errorf("mcp.profileBusyLoop not found with flat samples in %+v", entries)
+}
+
+var profileRetained [][]byte
+
+//go:noinline
+func profileAllocate() {
+	for i := 0; i < 64; i++ {
+		profileRetained = append(profileRetained, make([]byte, 64<<10))
+	}
+}
+
+func TestParsePprofHeapRoundTrip(t *testing.T) {
+	defer func(rate int) { runtime.MemProfileRate = rate }(runtime.MemProfileRate)
+	runtime.MemProfileRate = 1
+	profileAllocate()
+	defer func() { profileRetained = nil }()
+	// 内存 profile 在 GC 后才包含最近的分配
+	runtime.GC()
+
+	var buf bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	p, err := parsePprof(buf.Bytes())
+	if err != nil {
+		t.Fatalf("parsePprof: %v", err)
+	}
+	var types []string
+	for _, st := range p.SampleTypes {
+		types = append(types, st.Type)
+	}
+	if len(types) != 4 || types[1] != "alloc_space" || types[3] != "inuse_space" {
+		t.Fatalf("sample types = %v, want alloc_objects, alloc_space, inuse_objects, inuse_space", types)
+	}
+
+	for _, name := range []string{"inuse_space", "alloc_space"} {
+		index, err := p.sampleIndex(name)
+		if err != nil {
+			t.Fatalf("sampleIndex(%s): %v", name, err)
+		}
+		entries, total := p.summarize(index)
+		var found *ProfileEntry
+		for i := range entries {
+			if entries[i].Func == "mcp.profileAllocate" {
+				found = &entries[i]
+			}
+		}
+		if found == nil || found.Flat < 64*64<<10 {
+			t.Errorf("%s: mcp.profileAllocate = %+v, want flat >= %d (total %d)", name, found, 64*64<<10, total)
+		}
+	}
+}
+
+//go:noinline
+func profileBlock(ready chan<- struct{}, stop <-chan struct{}) {
+	close(ready)
+	<-stop
+}
+
+func TestParsePprofGoroutineRoundTrip(t *testing.T) {
+	const blocked = 3
+	ready := make([]chan struct{}, blocked)
+	stop := make(chan struct{})
+	defer close(stop)
+	for i := range ready {
+		ready[i] = make(chan struct{})
+		go profileBlock(ready[i], stop)
+	}
+	for _, r := range ready {
+		<-r
+	}
+
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 0); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	p, err := parsePprof(buf.Bytes())
+	if err != nil {
+		t.Fatalf("parsePprof: %v", err)
+	}
+	index, err := p.sampleIndex("")
+	if err != nil {
+		t.Fatalf("sampleIndex: %v", err)
+	}
+	if st := p.SampleTypes[index]; st.Type != "goroutine" || st.Unit != "count" {
+		t.Fatalf("default sample type = %+v, want goroutine/count", st)
+	}
+
+	entries, total := p.summarize(index)
+	// 阻塞的 goroutine、运行测试的 goroutine 和调用 WriteTo 的当前 goroutine
+	if total < blocked+1 {
+		t.Errorf("total = %d, want >= %d", total, blocked+1)
+	}
+	var block, gopark *ProfileEntry
+	for i := range entries {
+		switch entries[i].Func {
+		case "mcp.profileBlock":
+			block = &entries[i]
+		case "runtime.gopark":
+			gopark = &entries[i]
+		}
+	}
+	if block == nil || block.Cum < blocked || block.Flat != 0 {
+		t.Errorf("mcp.profileBlock = %+v, want cum >= %d and flat 0", block, blocked)
+	}
+	if gopark == nil || gopark.Flat < blocked {
+		t.Errorf("runtime.gopark = %+v, want flat >= %d", gopark, blocked)
+	}
+}
+
+func TestProfileFormatValue(t *testing.T) {
+	for _, tc := range []struct {
+		unit  string
+		value int64
+		want  string
+	}{
+		{"nanoseconds", 0, "0"},
+		{"nanoseconds", int64(1500 * time.Millisecond), "1.50s"},
+		{"nanoseconds", int64(20 * time.Millisecond), "20.00ms"},
+		{"nanoseconds", 1500, "1.50µs"},
+		{"bytes", 512, "512B"},
+		{"bytes", 3 << 20, "3.00MB"},
+		{"count", 42, "42"},
+	} {
+		r := &ProfileResult{Unit: tc.unit}
+		if got := r.formatValue(tc.value); got != tc.want {
+			t.Errorf("formatValue(%s, %d) = %q, want %q", tc.unit, tc.value, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 就绪探测方式（start_process 的 readiness.type 参数）
+const (
+	ProbeHTTP    = "http"    // 请求 URL，状态码和响应体符合条件视为就绪
+	ProbeTCP     = "tcp"     // 能连接 host:port 视为就绪
+	ProbeLog     = "log"     // 输出匹配正则的日志视为就绪
+	ProbeCommand = "command" // 执行命令退出码为 0 视为就绪
+	ProbeFile    = "file"    // 文件存在视为就绪
+	ProbeNone    = "none"    // 启动即就绪
+)
+
+const (
+	// defaultReadinessInterval 两次探测之间的默认间隔
+	defaultReadinessInterval = 500 * time.Millisecond
+	// defaultHTTPProbeTimeout HTTP 探测单次请求的默认超时时间
+	defaultHTTPProbeTimeout = 2 * time.Second
+	// commandProbeTimeout 探测命令单次执行的默认超时时间
+	commandProbeTimeout = 5 * time.Second
+	// httpProbeBodyLimit HTTP 探测读取响应体的上限
+	httpProbeBodyLimit = 64 * 1024
+)
+
+// ReadinessSpec 就绪探测配置（start_process / start_stack 的 readiness 参数，.gomcp.json 中服务的 readiness 字段）
+type ReadinessSpec struct {
+	Type    string   `json:"type" jsonschema:"探测方式：http（真正请求 url 或 health_check_url，校验状态码和响应体）、tcp（连接 address）、log（日志匹配 pattern）、command（执行 command 退出码为0）、file（path 存在）、none（启动即就绪）"`
+	URL     string   `json:"url,omitempty" jsonschema:"http 方式请求的URL，默认为 health_check_url"`
+	Address string   `json:"address,omitempty" jsonschema:"tcp 方式连接的地址，如 127.0.0.1:9090 或 :9090"`
+	Pattern string   `json:"pattern,omitempty" jsonschema:"log 方式匹配日志的正则表达式，如 'listening on'"`
+	Command string   `json:"command,omitempty" jsonschema:"command 方式执行的命令（可执行文件名），在进程的工作目录中以进程的环境变量执行"`
+	Args    []string `json:"args,omitempty" jsonschema:"command 方式的命令参数"`
+	Path    string   `json:"path,omitempty" jsonschema:"file 方式检查的文件路径，相对路径基于进程的工作目录"`
+
+	// http 方式的判定条件
+	ExpectStatus []int  `json:"expect_status,omitempty" jsonschema:"http 方式期望的状态码列表，如 [200, 204]，默认任意 2xx"`
+	BodyPattern  string `json:"body_pattern,omitempty" jsonschema:"http 方式要求响应体匹配的正则表达式"`
+	JSONField    string `json:"json_field,omitempty" jsonschema:"http 方式要求响应体为 JSON 且包含该字段（用 . 分隔的路径，如 status 或 checks.db.status），设置 json_equals 时还要求值相等"`
+	JSONEquals   string `json:"json_equals,omitempty" jsonschema:"json_field 的期望值（字符串直接比较，数字和布尔值按 JSON 文本比较，如 'ok'、'true'、'1'）"`
+
+	// 探测节奏
+	IntervalMs       int `json:"interval_ms,omitempty" jsonschema:"两次探测的间隔毫秒数，默认500"`
+	AttemptTimeoutMs int `json:"attempt_timeout_ms,omitempty" jsonschema:"单次探测的超时毫秒数（http 和 command 方式），默认 http 2000、command 5000"`
+}
+
+// ReadinessProbe 就绪探测，Check 执行一次检查，返回 nil 表示已就绪
+type ReadinessProbe interface {
+	Check(ctx context.Context, info *ProcessInfo) error
+	Describe() string
+}
+
+// newReadinessProbe 按启动参数创建就绪探测
+// 未配置 readiness 时请求 health_check_url，返回 2xx 才算就绪（端口已打开但返回 503 时仍在等待）
+// 只检查端口需要显式设置 readiness.type=tcp
+func newReadinessProbe(spec LaunchSpec) (ReadinessProbe, error) {
+	r := spec.Readiness
+	if r == nil {
+		if spec.HealthCheckURL == "" {
+			return nil, fmt.Errorf("必须提供 health_check_url 或 readiness")
+		}
+		return newHTTPProbe("readiness", &ReadinessSpec{}, spec.HealthCheckURL, spec.HealthCheckMethod)
+	}
+	return newProbe("readiness", r, spec.HealthCheckURL, spec.HealthCheckMethod)
+}
+
+// newProbe 校验探测配置并创建探测，就绪探测和存活探测共用
+// prefix 为参数名（readiness 或 liveness），用于错误信息
+func newProbe(prefix string, r *ReadinessSpec, healthCheckURL, method string) (ReadinessProbe, error) {
+	switch strings.ToLower(r.Type) {
+	case ProbeHTTP:
+		url := r.URL
+		if url == "" {
+			url = healthCheckURL
+		}
+		if url == "" {
+			return nil, fmt.Errorf("%s.type=http 时必须提供 %s.url 或 health_check_url", prefix, prefix)
+		}
+		probe, err := newHTTPProbe(prefix, r, url, method)
+		if err != nil {
+			return nil, err
+		}
+		return probe, nil
+	case ProbeTCP:
+		if _, _, err := net.SplitHostPort(r.Address); err != nil {
+			return nil, fmt.Errorf("%s.address '%s' 不是合法的 host:port: %v", prefix, r.Address, err)
+		}
+		return &tcpProbe{address: r.Address}, nil
+	case ProbeLog:
+		if r.Pattern == "" {
+			return nil, fmt.Errorf("%s.type=log 时必须提供 %s.pattern", prefix, prefix)
+		}
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s.pattern 不是合法的正则表达式: %v", prefix, err)
+		}
+		return &logProbe{pattern: pattern}, nil
+	case ProbeCommand:
+		if r.Command == "" || strings.Contains(r.Command, " ") {
+			return nil, fmt.Errorf("%s.type=command 时 %s.command 必须是可执行文件名（不含空格），参数放在 %s.args 中", prefix, prefix, prefix)
+		}
+		timeout := commandProbeTimeout
+		if r.AttemptTimeoutMs > 0 {
+			timeout = time.Duration(r.AttemptTimeoutMs) * time.Millisecond
+		}
+		return &commandProbe{command: r.Command, args: r.Args, timeout: timeout}, nil
+	case ProbeFile:
+		if r.Path == "" {
+			return nil, fmt.Errorf("%s.type=file 时必须提供 %s.path", prefix, prefix)
+		}
+		return &fileProbe{path: r.Path}, nil
+	case ProbeNone:
+		return noneProbe{}, nil
+	default:
+		return nil, fmt.Errorf("%s.type 只能是 http、tcp、log、command、file 或 none，收到 '%s'", prefix, r.Type)
+	}
+}
+
+// interval 两次探测之间的间隔
+func (r *ReadinessSpec) interval() time.Duration {
+	if r == nil || r.IntervalMs <= 0 {
+		return defaultReadinessInterval
+	}
+	return time.Duration(r.IntervalMs) * time.Millisecond
+}
+
+// waitForReady 按探测方式等待进程就绪，同时监控进程退出，超时错误中包含最后一次探测失败的原因
+func waitForReady(ctx context.Context, probe ReadinessProbe, info *ProcessInfo, timeout, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		err := probe.Check(ctx, info)
+		if err == nil {
+			return nil
+		}
+		// 整体超时打断的那次探测不算，保留之前真正的失败原因
+		if ctx.Err() == nil || lastErr == nil {
+			lastErr = err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("等待就绪超时（%s），最后一次探测失败: %v", probe.Describe(), lastErr)
+		case <-ticker.C:
+		case exitErr := <-info.ExitChan:
+			// 进程退出
+			if exitErr != nil {
+				return fmt.Errorf("进程异常退出: %v", exitErr)
+			}
+			return fmt.Errorf("进程已退出")
+		}
+	}
+}
+
+// tcpProbe 能建立 TCP 连接即就绪
+type tcpProbe struct {
+	address string
+}
+
+func (p *tcpProbe) Check(ctx context.Context, info *ProcessInfo) error {
+	conn, err := net.DialTimeout("tcp", p.address, 100*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+func (p *tcpProbe) Describe() string {
+	return "端口 " + p.address
+}
+
+// httpProbe 请求 URL，状态码、响应体、JSON 字段都满足条件即就绪
+type httpProbe struct {
+	url         string
+	method      string
+	statuses    []int // 为空表示任意 2xx
+	bodyPattern *regexp.Regexp
+	jsonField   string
+	jsonEquals  string
+	timeout     time.Duration
+}
+
+// newHTTPProbe 按探测配置中的 http 条件创建探测，prefix 为错误信息中的参数名
+func newHTTPProbe(prefix string, r *ReadinessSpec, url, method string) (*httpProbe, error) {
+	if method == "" {
+		method = "GET"
+	}
+	p := &httpProbe{
+		url:        url,
+		method:     method,
+		statuses:   r.ExpectStatus,
+		jsonField:  r.JSONField,
+		jsonEquals: r.JSONEquals,
+		timeout:    defaultHTTPProbeTimeout,
+	}
+	for _, status := range r.ExpectStatus {
+		if status < 100 || status > 599 {
+			return nil, fmt.Errorf("%s.expect_status 中的 %d 不是合法的状态码", prefix, status)
+		}
+	}
+	if r.BodyPattern != "" {
+		pattern, err := regexp.Compile(r.BodyPattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s.body_pattern 不是合法的正则表达式: %v", prefix, err)
+		}
+		p.bodyPattern = pattern
+	}
+	if r.JSONEquals != "" && r.JSONField == "" {
+		return nil, fmt.Errorf("%s.json_equals 需要与 json_field 一起使用", prefix)
+	}
+	if r.AttemptTimeoutMs > 0 {
+		p.timeout = time.Duration(r.AttemptTimeoutMs) * time.Millisecond
+	}
+	return p, nil
+}
+
+func (p *httpProbe) Check(ctx context.Context, info *ProcessInfo) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, p.method, p.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, httpProbeBodyLimit))
+
+	if !p.statusOK(resp.StatusCode) {
+		return fmt.Errorf("状态码 %d（期望 %s），响应: %s", resp.StatusCode, p.describeStatuses(), bodySnippet(body))
+	}
+	if p.bodyPattern != nil && !p.bodyPattern.Match(body) {
+		return fmt.Errorf("响应体不匹配 %s，响应: %s", p.bodyPattern, bodySnippet(body))
+	}
+	if p.jsonField != "" {
+		var data any
+		if err := json.Unmarshal(body, &data); err != nil {
+			return fmt.Errorf("响应体不是合法的 JSON: %v，响应: %s", err, bodySnippet(body))
+		}
+		value, ok := jsonFieldValue(data, p.jsonField)
+		if !ok {
+			return fmt.Errorf("响应 JSON 中没有字段 %s，响应: %s", p.jsonField, bodySnippet(body))
+		}
+		if p.jsonEquals != "" && value != p.jsonEquals {
+			return fmt.Errorf("JSON 字段 %s 为 %s（期望 %s）", p.jsonField, value, p.jsonEquals)
+		}
+	}
+	return nil
+}
+
+// statusOK 状态码是否符合期望
+func (p *httpProbe) statusOK(code int) bool {
+	if len(p.statuses) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, status := range p.statuses {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// describeStatuses 期望状态码的描述
+func (p *httpProbe) describeStatuses() string {
+	if len(p.statuses) == 0 {
+		return "2xx"
+	}
+	codes := make([]string, 0, len(p.statuses))
+	for _, status := range p.statuses {
+		codes = append(codes, strconv.Itoa(status))
+	}
+	return strings.Join(codes, "/")
+}
+
+func (p *httpProbe) Describe() string {
+	var conditions []string
+	if len(p.statuses) > 0 {
+		conditions = append(conditions, "状态码 "+p.describeStatuses())
+	}
+	if p.bodyPattern != nil {
+		conditions = append(conditions, "响应体匹配 "+p.bodyPattern.String())
+	}
+	if p.jsonField != "" {
+		if p.jsonEquals != "" {
+			conditions = append(conditions, fmt.Sprintf("JSON %s=%s", p.jsonField, p.jsonEquals))
+		} else {
+			conditions = append(conditions, "JSON 含 "+p.jsonField)
+		}
+	}
+	if len(conditions) == 0 {
+		return fmt.Sprintf("HTTP %s %s", p.method, p.url)
+	}
+	return fmt.Sprintf("HTTP %s %s（%s）", p.method, p.url, strings.Join(conditions, "，"))
+}
+
+// jsonFieldValue 按 . 分隔的路径取 JSON 字段的值（数组用数字下标），字符串返回原值，其余返回 JSON 文本
+func jsonFieldValue(data any, path string) (string, bool) {
+	current := data
+	for _, key := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]any:
+			value, ok := node[key]
+			if !ok {
+				return "", false
+			}
+			current = value
+		case []any:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return "", false
+			}
+			current = node[index]
+		default:
+			return "", false
+		}
+	}
+	if text, ok := current.(string); ok {
+		return text, true
+	}
+	encoded, _ := json.Marshal(current)
+	return string(encoded), true
+}
+
+// bodySnippet 响应体的前 200 个字符，用于错误信息
+func bodySnippet(body []byte) string {
+	text := strings.TrimSpace(string(body))
+	if text == "" {
+		return "（空）"
+	}
+	return truncateString(strings.Join(strings.Fields(text), " "), 200)
+}
+
+// logProbe 环形缓冲区中出现匹配的日志即就绪
+type logProbe struct {
+	pattern *regexp.Regexp
+}
+
+func (p *logProbe) Check(ctx context.Context, info *ProcessInfo) error {
+	if entries, _ := info.QueryLogs(LogQuery{Include: p.pattern, Tail: 1}); len(entries) > 0 {
+		return nil
+	}
+	return fmt.Errorf("尚未输出匹配 %s 的日志", p.pattern)
+}
+
+func (p *logProbe) Describe() string {
+	return "日志匹配 " + p.pattern.String()
+}
+
+// commandProbe 在进程的工作目录中以进程的环境变量执行命令，退出码为 0 即就绪
+type commandProbe struct {
+	command string
+	args    []string
+	timeout time.Duration
+}
+
+func (p *commandProbe) Check(ctx context.Context, info *ProcessInfo) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.command, p.args...)
+	cmd.Dir = info.Cmd.Dir
+	cmd.Env = info.Cmd.Env
+	setProcessGroupID(cmd)
+	cmd.WaitDelay = time.Second
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		if text := strings.TrimSpace(output.String()); text != "" {
+			return fmt.Errorf("%v: %s", err, truncateString(text, 200))
+		}
+		return err
+	}
+	return nil
+}
+
+func (p *commandProbe) Describe() string {
+	return "命令 " + strings.TrimSpace(p.command+" "+strings.Join(p.args, " "))
+}
+
+// fileProbe 文件存在即就绪
+type fileProbe struct {
+	path string
+}
+
+func (p *fileProbe) Check(ctx context.Context, info *ProcessInfo) error {
+	path := p.path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(info.Cmd.Dir, path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("文件 %s 不存在", path)
+		}
+		return err
+	}
+	return nil
+}
+
+func (p *fileProbe) Describe() string {
+	return "文件 " + p.path
+}
+
+// noneProbe 启动即就绪
+type noneProbe struct{}
+
+func (noneProbe) Check(ctx context.Context, info *ProcessInfo) error {
+	return nil
+}
+
+func (noneProbe) Describe() string {
+	return "无（启动即就绪）"
+}
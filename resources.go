@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// 进程资源 URI：process://{name}/logs（日志）和 process://{name}/info（进程信息）
+const (
+	resourceScheme = "process"
+	resourceLogs   = "logs"
+	resourceInfo   = "info"
+)
+
+// resourceUpdateInterval 日志资源更新通知的最小间隔，避免日志刷屏时通知过多
+const resourceUpdateInterval = 500 * time.Millisecond
+
+// processResourceURI 生成进程资源 URI
+func processResourceURI(name, kind string) string {
+	return fmt.Sprintf("%s://%s/%s", resourceScheme, name, kind)
+}
+
+// parseProcessResourceURI 解析进程资源 URI，返回进程名和资源类型
+func parseProcessResourceURI(uri string) (string, string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", "", fmt.Errorf("无效的资源URI: %w", err)
+	}
+	kind := strings.TrimPrefix(parsed.Path, "/")
+	if parsed.Scheme != resourceScheme || parsed.Host == "" || (kind != resourceLogs && kind != resourceInfo) {
+		return "", "", fmt.Errorf("无效的资源URI '%s'，格式应为 process://{name}/logs 或 process://{name}/info", uri)
+	}
+	return parsed.Host, kind, nil
+}
+
+// ResourceServerOptions 支持资源订阅的服务器选项
+func ResourceServerOptions() *mcp.ServerOptions {
+	return &mcp.ServerOptions{
+		SubscribeHandler: func(ctx context.Context, req *mcp.SubscribeRequest) error {
+			if _, _, err := parseProcessResourceURI(req.Params.URI); err != nil {
+				return err
+			}
+			GetLogger().Info("客户端订阅资源: %s", req.Params.URI)
+			return nil
+		},
+		UnsubscribeHandler: func(ctx context.Context, req *mcp.UnsubscribeRequest) error {
+			GetLogger().Info("客户端取消订阅资源: %s", req.Params.URI)
+			return nil
+		},
+	}
+}
+
+// RegisterResources 将本 mcp 管理的进程日志和信息注册为 MCP 资源
+// 进程启动时添加对应资源，日志写入或状态变化时向订阅者发送资源更新通知
+func RegisterResources(server *mcp.Server) {
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "process-logs",
+		Title:       "进程日志",
+		Description: "本mcp启动的进程的最近日志（最多1000条，带捕获时间和来源流）",
+		MIMEType:    "text/plain",
+		URITemplate: "process://{name}/logs",
+	}, readProcessResource)
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "process-info",
+		Title:       "进程信息",
+		Description: "本mcp启动的进程的状态信息（PID、命令、工作目录、健康检查、退出信息等）",
+		MIMEType:    "application/json",
+		URITemplate: "process://{name}/info",
+	}, readProcessResource)
+
+	processEvents.Subscribe(func(event ProcessEvent) {
+		switch event.Type {
+		case EventStarted:
+			server.AddResource(&mcp.Resource{
+				Name:     event.Process + "-logs",
+				Title:    fmt.Sprintf("%s 日志", event.Process),
+				MIMEType: "text/plain",
+				URI:      processResourceURI(event.Process, resourceLogs),
+			}, readProcessResource)
+			server.AddResource(&mcp.Resource{
+				Name:     event.Process + "-info",
+				Title:    fmt.Sprintf("%s 进程信息", event.Process),
+				MIMEType: "application/json",
+				URI:      processResourceURI(event.Process, resourceInfo),
+			}, readProcessResource)
+			if info, ok := processManager.GetProcess(event.Process); ok {
+				go watchLogResource(server, info)
+			}
+			notifyResourceUpdated(server, processResourceURI(event.Process, resourceInfo))
+		case EventHealthy, EventExited, EventCrashed, EventCrashLoop, EventUnhealthy, EventRecovered:
+			notifyResourceUpdated(server, processResourceURI(event.Process, resourceInfo))
+		}
+	})
+}
+
+// watchLogResource 进程写入新日志时通知日志资源的订阅者，直到日志处理结束
+func watchLogResource(server *mcp.Server, info *ProcessInfo) {
+	uri := processResourceURI(info.Name, resourceLogs)
+	updated := info.logUpdated()
+	for {
+		select {
+		case <-updated:
+		case <-info.logDone:
+			notifyResourceUpdated(server, uri)
+			return
+		}
+		// 先取新的通知 channel，限流期间写入的日志会使下一轮立即通知
+		updated = info.logUpdated()
+		notifyResourceUpdated(server, uri)
+
+		// 限流：间隔内的新日志合并到下一次通知
+		select {
+		case <-time.After(resourceUpdateInterval):
+		case <-info.logDone:
+			notifyResourceUpdated(server, uri)
+			return
+		}
+	}
+}
+
+// notifyResourceUpdated 发送资源更新通知（只发送给订阅了该资源的客户端）
+func notifyResourceUpdated(server *mcp.Server, uri string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{URI: uri}); err != nil {
+		GetLogger().Debug("发送资源更新通知失败: %v", err)
+	}
+}
+
+// readProcessResource 读取进程资源
+// 进程已被 kill_process 清理时，日志资源返回退出记录中的最后日志，信息资源返回退出记录
+func readProcessResource(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	uri := req.Params.URI
+	name, kind, err := parseProcessResourceURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	info, running := processManager.GetProcess(name)
+	record, hasRecord := processManager.GetExitRecord(name)
+	if !running && !hasRecord {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+
+	if kind == resourceLogs {
+		var entries []LogEntry
+		if running {
+			entries, _ = info.QueryLogs(LogQuery{})
+		} else {
+			entries = record.LastLogs
+		}
+		return &mcp.ReadResourceResult{
+			Contents: []*mcp.ResourceContents{
+				{URI: uri, MIMEType: "text/plain", Text: formatLogEntries(entries, false)},
+			},
+		}, nil
+	}
+
+	var data map[string]any
+	if running {
+		data, _, _ = describeProcess(info)
+	} else {
+		data = record.structured()
+		data["exited"] = true
+	}
+	text, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{
+			{URI: uri, MIMEType: "application/json", Text: string(text)},
+		},
+	}, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StackService 服务组中的一个服务：启动参数加上依赖的服务名
+type StackService struct {
+	Spec      LaunchSpec
+	DependsOn []string
+}
+
+// Stack 一组一起启动和停止的服务，Order 为按依赖关系排好的启动顺序
+type Stack struct {
+	Name  string
+	Order []string
+}
+
+// StackStep 服务组中一个服务的启动或停止结果
+type StackStep struct {
+	Service string
+	OK      bool
+	Skipped bool   // 依赖的服务启动失败，未启动
+	Detail  string // 启动结果或停止阶段
+}
+
+// orderStackServices 校验服务组并按依赖关系排序（被依赖的服务在前），同一层级保持传入顺序
+func orderStackServices(services []StackService) ([]StackService, error) {
+	if len(services) == 0 {
+		return nil, fmt.Errorf("services 不能为空")
+	}
+
+	byName := make(map[string]StackService, len(services))
+	for _, service := range services {
+		name := service.Spec.Name
+		if name == "" {
+			return nil, fmt.Errorf("服务缺少 name")
+		}
+		if _, exists := byName[name]; exists {
+			return nil, fmt.Errorf("服务名 '%s' 重复", name)
+		}
+		byName[name] = service
+	}
+
+	pending := make(map[string]int, len(services)) // 服务名 -> 尚未排序的依赖数
+	dependents := make(map[string][]string)        // 服务名 -> 依赖它的服务
+	for _, service := range services {
+		name := service.Spec.Name
+		for _, dep := range service.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("服务 '%s' 依赖的 '%s' 不在服务组中", name, dep)
+			}
+			if dep == name {
+				return nil, fmt.Errorf("服务 '%s' 不能依赖自身", name)
+			}
+			pending[name]++
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+
+	ordered := make([]StackService, 0, len(services))
+	done := make(map[string]bool, len(services))
+	for len(ordered) < len(services) {
+		progressed := false
+		for _, service := range services {
+			name := service.Spec.Name
+			if done[name] || pending[name] > 0 {
+				continue
+			}
+			done[name] = true
+			ordered = append(ordered, service)
+			for _, dependent := range dependents[name] {
+				pending[dependent]--
+			}
+			progressed = true
+		}
+		if !progressed {
+			var cycle []string
+			for _, service := range services {
+				if !done[service.Spec.Name] {
+					cycle = append(cycle, service.Spec.Name)
+				}
+			}
+			return nil, fmt.Errorf("depends_on 存在循环依赖: %s", strings.Join(cycle, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+// SaveStack 记录服务组的启动顺序，用于 stop_stack 按相反顺序停止
+func (pm *ProcessManager) SaveStack(stack Stack) {
+	stack.Order = append([]string(nil), stack.Order...)
+	pm.stacks.Store(stack.Name, stack)
+}
+
+// GetStack 获取服务组
+func (pm *ProcessManager) GetStack(name string) (Stack, bool) {
+	val, ok := pm.stacks.Load(name)
+	if !ok {
+		return Stack{}, false
+	}
+	return val.(Stack), true
+}
+
+// RemoveStack 删除服务组记录
+func (pm *ProcessManager) RemoveStack(name string) {
+	pm.stacks.Delete(name)
+}
+
+// stackReport 服务组启动或停止结果的文字报告
+func stackReport(title string, steps []StackStep, elapsed time.Duration) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("%s（耗时 %v）\n", title, elapsed.Round(time.Millisecond)))
+	for i, step := range steps {
+		mark := "✅"
+		switch {
+		case step.Skipped:
+			mark = "⏭️"
+		case !step.OK:
+			mark = "❌"
+		}
+		builder.WriteString(fmt.Sprintf("%d. %s %s: %s\n", i+1, mark, step.Service, firstLine(step.Detail)))
+	}
+	return builder.String()
+}
+
+// structuredStackSteps 服务组各服务结果的结构化形式
+func structuredStackSteps(steps []StackStep) []map[string]any {
+	items := make([]map[string]any, 0, len(steps))
+	for _, step := range steps {
+		items = append(items, map[string]any{
+			"service": step.Service,
+			"ok":      step.OK,
+			"skipped": step.Skipped,
+			"detail":  step.Detail,
+		})
+	}
+	return items
+}
+
+// firstLine 取多行文本的第一行
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 获取 goroutine 堆栈的方式（dump_stacks 的 method 参数）
+const (
+	StackMethodAuto   = "auto"   // 服务提供 pprof 时请求 pprof，否则发送 SIGQUIT
+	StackMethodPprof  = "pprof"  // 请求 /debug/pprof/goroutine?debug=2，不影响进程
+	StackMethodSignal = "signal" // 发送 SIGQUIT，Go 进程把堆栈打印到 stderr 后退出
+)
+
+const (
+	// defaultQuitDumpWait 发送 SIGQUIT 后等待堆栈输出的默认时间
+	defaultQuitDumpWait = 5 * time.Second
+	// quitDumpQuiet 进程处理了 SIGQUIT 没有退出时，堆栈之后日志静默该时长视为输出完毕
+	quitDumpQuiet = 300 * time.Millisecond
+	// stackGroupIDLimit 每组最多列出的 goroutine ID 数量
+	stackGroupIDLimit = 10
+	// pprofGoroutinePath Go 进程导入 net/http/pprof 后提供的 goroutine 堆栈接口
+	pprofGoroutinePath = "/debug/pprof/goroutine?debug=2"
+)
+
+var (
+	// goroutineHeaderPattern 协程头，如 "goroutine 7 [chan receive, 5 minutes]:"
+	// GOTRACEBACK=system 时中间还有 gp=0x... m=... 等字段
+	goroutineHeaderPattern = regexp.MustCompile(`^goroutine (\d+)(?: [^\[]*)?\[([^\]]*)\]:?$`)
+	// waitMinutesPattern 协程状态中的等待时长，如 "5 minutes"
+	waitMinutesPattern = regexp.MustCompile(`^(\d+) minutes?$`)
+)
+
+// StackFrame 堆栈中的一帧
+type StackFrame struct {
+	Func     string // 函数名（不含参数），如 main.(*Server).handle
+	Location string // 文件和行号，如 /app/server.go:42
+}
+
+// Goroutine 堆栈转储中的一个 goroutine
+type Goroutine struct {
+	ID        int
+	State     string // 如 chan receive、sync.Mutex.Lock、IO wait
+	Wait      string // 等待时长，如 "5 minutes"，不足 1 分钟时为空
+	Frames    []StackFrame
+	CreatedBy *StackFrame
+}
+
+// GoroutineGroup 堆栈相同的一组 goroutine
+type GoroutineGroup struct {
+	Count     int
+	IDs       []int          // 最多 stackGroupIDLimit 个
+	States    map[string]int // 状态 -> 数量
+	MaxWait   string         // 组内最长的等待时长
+	Frames    []StackFrame
+	CreatedBy *StackFrame
+
+	maxWaitMinutes int
+}
+
+// StackDump 一次 goroutine 堆栈转储
+type StackDump struct {
+	Method     string // pprof 或 signal
+	Source     string // 请求的 URL 或信号说明
+	Raw        string // 原始堆栈
+	File       string // 原始堆栈保存的文件，保存失败时为空
+	Goroutines []Goroutine
+	Groups     []GoroutineGroup
+	Exited     bool // 进程收到 SIGQUIT 后已退出
+}
+
+// captureStacks 按指定方式获取进程的 goroutine 堆栈，解析、去重并把原始堆栈保存到 logs 目录
+// auto 方式在 pprof 不可用时发送 SIGQUIT，wait 为发送 SIGQUIT 后等待堆栈输出的最长时间
+func captureStacks(info *ProcessInfo, method string, wait time.Duration) (*StackDump, error) {
+	dump := &StackDump{Method: method}
+	var err error
+	switch method {
+	case StackMethodPprof:
+		dump.Raw, dump.Source, err = fetchPprofGoroutines(info)
+	case StackMethodSignal:
+		dump.Raw, dump.Exited, err = captureQuitDump(info, wait)
+		dump.Source = fmt.Sprintf("SIGQUIT → PID %d", info.Cmd.Process.Pid)
+	default:
+		dump.Method = StackMethodPprof
+		dump.Raw, dump.Source, err = fetchPprofGoroutines(info)
+		if err != nil {
+			pprofErr := err
+			GetLogger().Info("进程 %s 的 pprof 不可用（%v），改为发送 SIGQUIT", info.Name, pprofErr)
+			dump.Method = StackMethodSignal
+			dump.Source = fmt.Sprintf("SIGQUIT → PID %d（pprof 不可用: %v）", info.Cmd.Process.Pid, pprofErr)
+			dump.Raw, dump.Exited, err = captureQuitDump(info, wait)
+			if err != nil {
+				err = fmt.Errorf("pprof 不可用: %v；SIGQUIT 失败: %v", pprofErr, err)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dump.Goroutines = parseGoroutineDump(dump.Raw)
+	if len(dump.Goroutines) == 0 {
+		return nil, fmt.Errorf("没有从输出中解析出 goroutine 堆栈: %s", truncateString(dump.Raw, 200))
+	}
+	dump.Groups = groupGoroutines(dump.Goroutines)
+	if path, err := writeLogsFile("goroutines_"+info.Name, ".txt", []byte(dump.Raw)); err != nil {
+		GetLogger().Error("保存 goroutine 堆栈失败: %v", err)
+	} else {
+		dump.File = path
+	}
+	return dump, nil
+}
+
+// fetchPprofGoroutines 请求进程的 pprof 接口获取全部 goroutine 堆栈，返回堆栈和请求的 URL
+func fetchPprofGoroutines(info *ProcessInfo) (string, string, error) {
+	target, err := debugURL(info, pprofGoroutinePath)
+	if err != nil {
+		return "", "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("请求 %s 失败: %v", target, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("%s 返回状态码 %d（进程可能未导入 net/http/pprof）", target, resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", fmt.Errorf("读取 goroutine 堆栈失败: %v", err)
+	}
+	return string(data), target, nil
+}
+
+// captureQuitDump 向进程发送 SIGQUIT，从日志中取出 Go 运行时打印的 goroutine 堆栈
+// 堆栈经由日志管道合并为一条日志；进程退出，或处理了信号未退出但堆栈已输出完毕时返回
+func captureQuitDump(info *ProcessInfo, wait time.Duration) (string, bool, error) {
+	if exited, _, _ := info.ExitStatus(); exited {
+		return "", true, fmt.Errorf("进程已退出")
+	}
+	if wait <= 0 {
+		wait = defaultQuitDumpWait
+	}
+
+	// Go 进程打印堆栈后会以退出码 2 退出，标记为主动终止，避免重启策略把它当作崩溃
+	info.stopRequested.Store(true)
+	since := time.Now()
+	if err := quitProcessTree(info.Cmd.Process.Pid); err != nil {
+		info.stopRequested.Store(false)
+		return "", false, fmt.Errorf("发送 SIGQUIT 失败: %v", err)
+	}
+	GetLogger().Info("已向进程 %s (PID: %d) 发送 SIGQUIT", info.Name, info.Cmd.Process.Pid)
+
+	query := LogQuery{Since: since, StackTraceOnly: true}
+	exited := false
+	deadline := time.After(wait)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+collect:
+	for {
+		select {
+		case <-info.waitDone:
+			// 等待退出前的日志处理完，确保堆栈完整
+			select {
+			case <-info.logDone:
+			case <-time.After(2 * time.Second):
+			}
+			exited = true
+			break collect
+		case <-deadline:
+			break collect
+		case <-ticker.C:
+			if entries, _ := info.QueryLogs(query); len(entries) > 0 && time.Since(entries[len(entries)-1].Time) >= quitDumpQuiet {
+				break collect
+			}
+		}
+	}
+	if !exited {
+		// 进程捕获了 SIGQUIT 没有退出，之后的退出仍按意外退出处理
+		info.stopRequested.Store(false)
+	}
+
+	entries, _ := info.QueryLogs(query)
+	var lines []string
+	for _, entry := range entries {
+		// 协程很多时转储会按合并上限拆成多条日志，拆出的部分以续行开头
+		first, _, _ := strings.Cut(entry.Line, "\n")
+		if strings.Contains(entry.Line, "goroutine ") || len(lines) > 0 && (strings.HasPrefix(first, "\t") || goTraceLinePattern.MatchString(first)) {
+			lines = append(lines, entry.Line)
+		}
+	}
+	if len(lines) == 0 {
+		return "", exited, fmt.Errorf("发送 SIGQUIT 后 %v 内没有输出 goroutine 堆栈（进程可能不是 Go 程序，或自行处理了 SIGQUIT）", wait)
+	}
+	return strings.Join(lines, "\n"), exited, nil
+}
+
+// parseGoroutineDump 解析 pprof debug=2 或 SIGQUIT 输出的 goroutine 堆栈（两者格式相同）
+// 日志管道会去掉空行，因此以协程头而不是空行分隔各个 goroutine
+func parseGoroutineDump(raw string) []Goroutine {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	var goroutines []Goroutine
+	var current *Goroutine
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if m := goroutineHeaderPattern.FindStringSubmatch(line); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			state, wait, _ := strings.Cut(m[2], ", ")
+			goroutines = append(goroutines, Goroutine{ID: id, State: state, Wait: wait})
+			current = &goroutines[len(goroutines)-1]
+			continue
+		}
+		if current == nil || line == "" || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		// 函数行的下一行是缩进的文件位置，其余不缩进的行（寄存器、exit status 等）不是堆栈帧
+		if i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], "\t") {
+			if strings.HasPrefix(line, "...") {
+				current.Frames = append(current.Frames, StackFrame{Func: line})
+			}
+			continue
+		}
+		i++
+		location := strings.TrimSpace(lines[i])
+		if fields := strings.Fields(location); len(fields) > 0 {
+			location = fields[0]
+		}
+		if after, ok := strings.CutPrefix(line, "created by "); ok {
+			fn, _, _ := strings.Cut(after, " in goroutine ")
+			current.CreatedBy = &StackFrame{Func: fn, Location: location}
+			continue
+		}
+		current.Frames = append(current.Frames, StackFrame{Func: trimFrameArgs(line), Location: location})
+	}
+
+	// goroutine 0 是 SIGQUIT 时收到信号的系统线程，不是业务代码
+	result := goroutines[:0]
+	for _, g := range goroutines {
+		if g.ID != 0 {
+			g.Frames = trimRuntimeFrames(g.Frames)
+			result = append(result, g)
+		}
+	}
+	return result
+}
+
+// trimRuntimeFrames 去掉开头的运行时内部帧（runtime.gopark 等）和末尾的 runtime.goexit，
+// 使 SIGQUIT 的堆栈与 pprof 的一致；全部是运行时帧时（如 GC 协程）保留原样
+func trimRuntimeFrames(frames []StackFrame) []StackFrame {
+	if n := len(frames); n > 0 && frames[n-1].Func == "runtime.goexit" {
+		frames = frames[:n-1]
+	}
+	for i, frame := range frames {
+		if !strings.HasPrefix(frame.Func, "runtime.") {
+			return frames[i:]
+		}
+	}
+	return frames
+}
+
+// trimFrameArgs 去掉函数行末尾的参数，如 main.(*T).run(0xc000010000, {0x1, 0x2}) -> main.(*T).run
+func trimFrameArgs(line string) string {
+	if strings.HasSuffix(line, ")") {
+		if i := strings.LastIndex(line, "("); i > 0 {
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// groupGoroutines 按堆栈（函数和位置，忽略参数和状态）去重，数量多的组在前
+func groupGoroutines(goroutines []Goroutine) []GoroutineGroup {
+	index := make(map[string]int)
+	var groups []GoroutineGroup
+	for _, g := range goroutines {
+		var key strings.Builder
+		for _, frame := range g.Frames {
+			key.WriteString(frame.Func + "@" + frame.Location + "\n")
+		}
+		if g.CreatedBy != nil {
+			key.WriteString("created by " + g.CreatedBy.Func + "@" + g.CreatedBy.Location)
+		}
+
+		i, ok := index[key.String()]
+		if !ok {
+			i = len(groups)
+			index[key.String()] = i
+			groups = append(groups, GoroutineGroup{
+				States:    make(map[string]int),
+				Frames:    g.Frames,
+				CreatedBy: g.CreatedBy,
+			})
+		}
+		group := &groups[i]
+		group.Count++
+		if len(group.IDs) < stackGroupIDLimit {
+			group.IDs = append(group.IDs, g.ID)
+		}
+		group.States[g.State]++
+		if m := waitMinutesPattern.FindStringSubmatch(g.Wait); m != nil {
+			if minutes, _ := strconv.Atoi(m[1]); minutes > group.maxWaitMinutes {
+				group.maxWaitMinutes = minutes
+				group.MaxWait = g.Wait
+			}
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Count > groups[j].Count
+	})
+	return groups
+}
+
+// waitingOnLock 是否在等待锁（sync.Mutex、sync.RWMutex、信号量）
+func (g GoroutineGroup) waitingOnLock() bool {
+	for state := range g.States {
+		if strings.Contains(state, "Mutex") || strings.HasPrefix(state, "semacquire") {
+			return true
+		}
+	}
+	return false
+}
+
+// describeStates 状态描述，如 "chan receive" 或 "IO wait 3 个，running 1 个"
+func (g GoroutineGroup) describeStates() string {
+	states := make([]string, 0, len(g.States))
+	for state := range g.States {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	if len(states) == 1 {
+		return states[0]
+	}
+	for i, state := range states {
+		states[i] = fmt.Sprintf("%s %d 个", state, g.States[state])
+	}
+	return strings.Join(states, "，")
+}
+
+// Summary 一行摘要，用于不健康处理等场景
+func (d *StackDump) Summary() string {
+	text := fmt.Sprintf("goroutine 堆栈（%s，%d 个，%d 组）", d.Method, len(d.Goroutines), len(d.Groups))
+	if d.File != "" {
+		text += "已保存到 " + d.File
+	}
+	return text
+}
+
+// Report 按组列出堆栈，最多 maxGroups 组，每组最多 maxFrames 帧
+func (d *StackDump) Report(name string, maxGroups, maxFrames int) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("进程 %s 的 goroutine 堆栈\n", name))
+	builder.WriteString(fmt.Sprintf("方式: %s（%s）\n", d.Method, d.Source))
+	builder.WriteString(fmt.Sprintf("共 %d 个 goroutine，按堆栈去重后 %d 组\n", len(d.Goroutines), len(d.Groups)))
+	if d.File != "" {
+		builder.WriteString(fmt.Sprintf("完整堆栈已保存到: %s\n", d.File))
+	}
+
+	locked := 0
+	for _, group := range d.Groups {
+		if group.waitingOnLock() {
+			locked += group.Count
+		}
+	}
+	if locked > 0 {
+		builder.WriteString(fmt.Sprintf("⚠️ 有 %d 个 goroutine 在等待锁，如果多次获取堆栈等待时间持续增长，可能是死锁\n", locked))
+	}
+
+	for i, group := range d.Groups {
+		if i >= maxGroups {
+			builder.WriteString(fmt.Sprintf("\n...（还有 %d 组未显示，见完整堆栈文件）\n", len(d.Groups)-maxGroups))
+			break
+		}
+		header := fmt.Sprintf("%d 个 goroutine [%s", group.Count, group.describeStates())
+		if group.MaxWait != "" {
+			header += "，最长等待 " + group.MaxWait
+		}
+		builder.WriteString(fmt.Sprintf("\n### %d. %s]\n", i+1, header))
+
+		ids := make([]string, len(group.IDs))
+		for j, id := range group.IDs {
+			ids[j] = strconv.Itoa(id)
+		}
+		idText := strings.Join(ids, ", ")
+		if group.Count > len(group.IDs) {
+			idText += ", ..."
+		}
+		builder.WriteString(fmt.Sprintf("goroutine: %s\n", idText))
+
+		for j, frame := range group.Frames {
+			if j >= maxFrames {
+				builder.WriteString(fmt.Sprintf("  ...（省略 %d 帧）\n", len(group.Frames)-maxFrames))
+				break
+			}
+			builder.WriteString(fmt.Sprintf("  %s\n", frame.Func))
+			if frame.Location != "" {
+				builder.WriteString(fmt.Sprintf("      %s\n", frame.Location))
+			}
+		}
+		if group.CreatedBy != nil {
+			builder.WriteString(fmt.Sprintf("  created by %s\n      %s\n", group.CreatedBy.Func, group.CreatedBy.Location))
+		}
+	}
+	return builder.String()
+}
+
+// structured 堆栈转储的结构化形式，最多 maxGroups 组
+func (d *StackDump) structured(name string, maxGroups int) map[string]any {
+	groups := make([]map[string]any, 0, len(d.Groups))
+	for i, group := range d.Groups {
+		if i >= maxGroups {
+			break
+		}
+		frames := make([]map[string]any, 0, len(group.Frames))
+		for _, frame := range group.Frames {
+			frames = append(frames, map[string]any{"func": frame.Func, "location": frame.Location})
+		}
+		item := map[string]any{
+			"count":  group.Count,
+			"ids":    group.IDs,
+			"states": group.States,
+			"frames": frames,
+		}
+		if group.MaxWait != "" {
+			item["max_wait"] = group.MaxWait
+		}
+		if group.CreatedBy != nil {
+			item["created_by"] = map[string]any{"func": group.CreatedBy.Func, "location": group.CreatedBy.Location}
+		}
+		groups = append(groups, item)
+	}
+	result := map[string]any{
+		"name":        name,
+		"method":      d.Method,
+		"source":      d.Source,
+		"goroutines":  len(d.Goroutines),
+		"group_count": len(d.Groups),
+		"groups":      groups,
+		"exited":      d.Exited,
+	}
+	if d.File != "" {
+		result["file"] = d.File
+	}
+	return result
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// quitDump GOTRACEBACK=system 时 SIGQUIT 的输出（节选）：协程头带 gp=/m=，末尾是寄存器和 go run 的退出状态
+const quitDump = `SIGQUIT: quit
+PC=0x41148e m=0 sigcode=0
+
+goroutine 0 gp=0xa44dc0 m=0 mp=0xa45d60 [idle]:
+internal/runtime/syscall/linux.Syscall6()
+	/usr/local/go/src/internal/runtime/syscall/linux/asm_linux_amd64.s:36 +0xe fp=0x7ffd8a402b58 sp=0x7ffd8a402b50 pc=0x41148e
+runtime.mcall()
+	/usr/local/go/src/runtime/asm_amd64.s:463 +0x53 fp=0x7ffd8a403478 sp=0x7ffd8a403460 pc=0x491473
+
+goroutine 7 gp=0x399cd584a000 m=nil [chan receive, 5 minutes]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:474 +0xca fp=0x399cd5866f38 sp=0x399cd5866f18 pc=0x48c12a
+runtime.chanrecv(0x399cd5840000, 0x0, 0x1)
+	/usr/local/go/src/runtime/chan.go:664 +0x445 fp=0x399cd5866fb0 sp=0x399cd5866f38 pc=0x41a705
+runtime.chanrecv1(0x0?, 0x0?)
+	/usr/local/go/src/runtime/chan.go:506 +0x12 fp=0x399cd5866fd8 sp=0x399cd5866fb0 pc=0x41a292
+main.worker(...)
+	/tmp/hang/main.go:21
+runtime.goexit({})
+	/usr/local/go/src/runtime/asm_amd64.s:1264 +0x1 fp=0x399cd5866fe8 sp=0x399cd5866fe0 pc=0x492fc1
+created by main.main in goroutine 1
+	/tmp/hang/main.go:26 +0x3e
+
+goroutine 14 gp=0x399cd584ad20 m=nil [sync.Mutex.Lock, 12 minutes]:
+runtime.gopark(0xa4e520?, 0x646280?, 0x30?, 0x82?, 0x399cd57f0970?)
+	/usr/local/go/src/runtime/proc.go:474 +0xca fp=0x399cd57f0968 sp=0x399cd57f0948 pc=0x48c12a
+runtime.goparkunlock(...)
+	/usr/local/go/src/runtime/proc.go:480
+runtime.semacquire1(0xa65e34, 0x0, 0x3, 0x2, 0x16)
+	/usr/local/go/src/runtime/sema.go:192 +0x232 fp=0x399cd57f09d0 sp=0x399cd57f0968 pc=0x4662d2
+internal/sync.runtime_SemacquireMutex(0x5?, 0x0?, 0x399cd57f0a70?)
+	/usr/local/go/src/runtime/sema.go:95 +0x25 fp=0x399cd57f0a08 sp=0x399cd57f09d0 pc=0x48d4c5
+sync.(*Mutex).Lock(...)
+	/usr/local/go/src/sync/mutex.go:46
+main.main.func2({0x399cd57bc2bc?, 0x4914d2?}, 0x0?)
+	/tmp/hang/main.go:31 +0x35 fp=0x399cd57f0a70 sp=0x399cd57f0a58 pc=0x67da35
+...additional frames elided...
+created by net/http.(*Server).Serve in goroutine 1
+	/usr/local/go/src/net/http/server.go:3581 +0x4fd
+
+goroutine 15 gp=0x399cd584af00 m=nil [sync.Mutex.Lock]:
+runtime.gopark(0x1?, 0x2?, 0x30?, 0x82?, 0x399cd57f1970?)
+	/usr/local/go/src/runtime/proc.go:474 +0xca fp=0x399cd57f1968 sp=0x399cd57f1948 pc=0x48c12a
+runtime.goparkunlock(...)
+	/usr/local/go/src/runtime/proc.go:480
+runtime.semacquire1(0xa65e34, 0x0, 0x3, 0x2, 0x16)
+	/usr/local/go/src/runtime/sema.go:192 +0x232 fp=0x399cd57f19d0 sp=0x399cd57f1968 pc=0x4662d2
+internal/sync.runtime_SemacquireMutex(0x5?, 0x0?, 0x399cd57f1a70?)
+	/usr/local/go/src/runtime/sema.go:95 +0x25 fp=0x399cd57f1a08 sp=0x399cd57f19d0 pc=0x48d4c5
+sync.(*Mutex).Lock(...)
+	/usr/local/go/src/sync/mutex.go:46
+main.main.func2({0x399cd57bc2d4?, 0x4914d2?}, 0x0?)
+	/tmp/hang/main.go:31 +0x35 fp=0x399cd57f1a70 sp=0x399cd57f1a58 pc=0x67da35
+...additional frames elided...
+created by net/http.(*Server).Serve in goroutine 1
+	/usr/local/go/src/net/http/server.go:3581 +0x4fd
+
+rax    0xfffffffffffffffc
+rbx    0x5
+rip    0x41148e
+rflags 0x246
+cs     0x33
+exit status 2`
+
+// pprofDump /debug/pprof/goroutine?debug=2 的输出（节选）：协程头不带 gp=/m=，帧中没有 fp=/sp=
+const pprofDump = `goroutine 1 [running]:
+runtime/pprof.writeGoroutineStacks({0x9f2e60, 0xc0001a2000})
+	/usr/local/go/src/runtime/pprof/pprof.go:761 +0x6a
+net/http.(*conn).serve(0xc000198000, {0x9f43c8, 0xc000180190})
+	/usr/local/go/src/net/http/server.go:2137 +0x6dc
+created by net/http.(*Server).Serve in goroutine 6
+	/usr/local/go/src/net/http/server.go:3581 +0x4fd
+
+goroutine 9 [select, 3 minutes]:
+main.(*Server).loop(0xc0000a4000)
+	/app/server.go:88 +0x11c
+created by main.main in goroutine 1
+	/app/main.go:17 +0x6b
+`
+
+func TestParseGoroutineDump(t *testing.T) {
+	lockFrames := []StackFrame{
+		{Func: "internal/sync.runtime_SemacquireMutex", Location: "/usr/local/go/src/runtime/sema.go:95"},
+		{Func: "sync.(*Mutex).Lock", Location: "/usr/local/go/src/sync/mutex.go:46"},
+		{Func: "main.main.func2", Location: "/tmp/hang/main.go:31"},
+		{Func: "...additional frames elided..."},
+	}
+	serveCreator := &StackFrame{Func: "net/http.(*Server).Serve", Location: "/usr/local/go/src/net/http/server.go:3581"}
+	quitWant := []Goroutine{
+		{
+			ID: 7, State: "chan receive", Wait: "5 minutes",
+			Frames:    []StackFrame{{Func: "main.worker", Location: "/tmp/hang/main.go:21"}},
+			CreatedBy: &StackFrame{Func: "main.main", Location: "/tmp/hang/main.go:26"},
+		},
+		{ID: 14, State: "sync.Mutex.Lock", Wait: "12 minutes", Frames: lockFrames, CreatedBy: serveCreator},
+		{ID: 15, State: "sync.Mutex.Lock", Frames: lockFrames, CreatedBy: serveCreator},
+	}
+	pprofWant := []Goroutine{
+		{
+			ID: 1, State: "running",
+			Frames: []StackFrame{
+				{Func: "runtime/pprof.writeGoroutineStacks", Location: "/usr/local/go/src/runtime/pprof/pprof.go:761"},
+				{Func: "net/http.(*conn).serve", Location: "/usr/local/go/src/net/http/server.go:2137"},
+			},
+			CreatedBy: serveCreator,
+		},
+		{
+			ID: 9, State: "select", Wait: "3 minutes",
+			Frames:    []StackFrame{{Func: "main.(*Server).loop", Location: "/app/server.go:88"}},
+			CreatedBy: &StackFrame{Func: "main.main", Location: "/app/main.go:17"},
+		},
+	}
+
+	for _, tc := range []struct {
+		name string
+		raw  string
+		want []Goroutine
+	}{
+		{"sigquit", quitDump, quitWant},
+		// 日志管道会去掉空行
+		{"sigquit without blank lines", strings.ReplaceAll(quitDump, "\n\n", "\n"), quitWant},
+		{"sigquit with CRLF", strings.ReplaceAll(quitDump, "\n", "\r\n"), quitWant},
+		{"pprof", pprofDump, pprofWant},
+		{"empty", "", nil},
+		{"not a dump", "listening on :8080\nexit status 1", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := parseGoroutineDump(tc.raw)
+			if len(got) == 0 && len(tc.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseGoroutineDump() =\n%+v\nwant\n%+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGroupGoroutines(t *testing.T) {
+	groups := groupGoroutines(parseGoroutineDump(quitDump))
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want 2: %+v", len(groups), groups)
+	}
+	lock := groups[0]
+	if lock.Count != 2 || !reflect.DeepEqual(lock.IDs, []int{14, 15}) {
+		t.Errorf("first group: count %d, ids %v, want 2 goroutines 14 and 15", lock.Count, lock.IDs)
+	}
+	if lock.States["sync.Mutex.Lock"] != 2 || lock.MaxWait != "12 minutes" {
+		t.Errorf("first group: states %v, max wait %q", lock.States, lock.MaxWait)
+	}
+	if !lock.waitingOnLock() {
+		t.Error("first group should be waiting on a lock")
+	}
+	if groups[1].Count != 1 || groups[1].IDs[0] != 7 || groups[1].waitingOnLock() {
+		t.Errorf("second group = %+v, want goroutine 7 not waiting on a lock", groups[1])
+	}
+}
+
+func TestTrimFrameArgs(t *testing.T) {
+	for _, tc := range []struct{ line, want string }{
+		{"main.main()", "main.main"},
+		{"main.(*T).run(0xc000010000, {0x1, 0x2})", "main.(*T).run"},
+		{"sync.(*Mutex).Lock(...)", "sync.(*Mutex).Lock"},
+		{"main.main.func2({0x399cd57bc2bc?, 0x4914d2?}, 0x0?)", "main.main.func2"},
+		{"...additional frames elided...", "...additional frames elided..."},
+	} {
+		if got := trimFrameArgs(tc.line); got != tc.want {
+			t.Errorf("trimFrameArgs(%q) = %q, want %q", tc.line, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 重启策略（start_process 的 restart_policy 参数）
+const (
+	RestartNever     = "never"      // 不自动重启（默认）
+	RestartOnFailure = "on-failure" // 退出码非 0 或被信号终止时重启
+	RestartAlways    = "always"     // 任何意外退出都重启
+)
+
+const (
+	defaultMaxRestarts    = 5
+	defaultRestartBackoff = time.Second
+	maxRestartBackoff     = 30 * time.Second
+	// stableUptime 进程运行超过该时长后退出不算崩溃循环，重新计算重启次数
+	stableUptime       = 30 * time.Second
+	restartHistorySize = 20
+)
+
+// RestartPolicy 进程意外退出后的自动重启策略
+type RestartPolicy struct {
+	Mode       string
+	MaxRetries int           // 连续重启次数上限，超过视为崩溃循环并停止重启
+	Backoff    time.Duration // 首次重启前的等待时间，之后每次翻倍，最长 30 秒
+}
+
+// newRestartPolicy 校验参数并补充默认值，never 返回 nil
+func newRestartPolicy(mode string, maxRetries, backoffMs int) (*RestartPolicy, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "", RestartNever:
+		return nil, nil
+	case RestartOnFailure, RestartAlways:
+	default:
+		return nil, fmt.Errorf("restart_policy 只能是 never、on-failure 或 always，收到 '%s'", mode)
+	}
+
+	policy := &RestartPolicy{
+		Mode:       mode,
+		MaxRetries: maxRetries,
+		Backoff:    time.Duration(backoffMs) * time.Millisecond,
+	}
+	if policy.MaxRetries <= 0 {
+		policy.MaxRetries = defaultMaxRestarts
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = defaultRestartBackoff
+	}
+	return policy, nil
+}
+
+// shouldRestart 根据退出记录判断是否需要重启（主动终止的进程不重启）
+func (p *RestartPolicy) shouldRestart(record *ExitRecord) bool {
+	if record.Expected {
+		return false
+	}
+	return p.Mode == RestartAlways || record.ExitCode != 0
+}
+
+// delay 第 attempt 次连续重启前的等待时间（指数退避）
+func (p *RestartPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < maxRestartBackoff; i++ {
+		d *= 2
+	}
+	if d > maxRestartBackoff {
+		d = maxRestartBackoff
+	}
+	return d
+}
+
+// String 策略描述，如 "on-failure（最多连续重启 5 次，退避 1s 起）"
+func (p *RestartPolicy) String() string {
+	return fmt.Sprintf("%s（最多连续重启 %d 次，退避 %v 起）", p.Mode, p.MaxRetries, p.Backoff)
+}
+
+// RestartRecord 一次自动重启的记录
+type RestartRecord struct {
+	Attempt int           // 连续重启的第几次
+	Time    time.Time     // 开始重启的时间
+	Reason  string        // 触发重启的退出原因
+	Delay   time.Duration // 重启前等待的时间
+	Healthy bool          // 重启后健康检查是否通过
+	Output  string        // 重启失败时的启动结果
+}
+
+// supervisor 按重启策略监督进程：进程意外退出后按退避时间重启，连续失败超过上限时停止
+type supervisor struct {
+	name    string
+	policy  *RestartPolicy
+	restart func(stop <-chan struct{}) (healthy bool, output string, ok bool)
+	stop    chan struct{}
+
+	mu         sync.Mutex
+	attempts   int  // 当前连续重启次数
+	recovering bool // 正在重启中，期间的退出不重复处理
+	history    []RestartRecord
+	crashLoop  string // 检测到崩溃循环时的报告，空表示正常
+}
+
+// StartSupervisor 开始按重启策略监督进程，已有监督时替换为新策略
+// restart 负责重启进程，stop 关闭表示监督已停止，此时不应再重启（返回 ok=false）
+func (pm *ProcessManager) StartSupervisor(name string, policy *RestartPolicy, restart func(stop <-chan struct{}) (bool, string, bool)) {
+	pm.StopSupervisor(name)
+	pm.supervisors.Store(name, &supervisor{
+		name:    name,
+		policy:  policy,
+		restart: restart,
+		stop:    make(chan struct{}),
+	})
+	GetLogger().Info("进程 %s 启用重启策略: %s", name, policy)
+}
+
+// StopSupervisor 停止监督，没有监督时什么都不做
+func (pm *ProcessManager) StopSupervisor(name string) {
+	val, ok := pm.supervisors.LoadAndDelete(name)
+	if !ok {
+		return
+	}
+	close(val.(*supervisor).stop)
+	GetLogger().Info("进程 %s 的重启策略已停止", name)
+}
+
+// getSupervisor 获取进程的监督者
+func (pm *ProcessManager) getSupervisor(name string) (*supervisor, bool) {
+	val, ok := pm.supervisors.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return val.(*supervisor), true
+}
+
+// superviseExit 进程退出后由 monitorProcessExit 调用，按重启策略决定是否重启
+// 只处理健康检查通过过的进程：启动阶段的失败由启动它的工具调用直接报告
+func (pm *ProcessManager) superviseExit(info *ProcessInfo, record *ExitRecord) {
+	s, ok := pm.getSupervisor(info.Name)
+	if !ok || !info.healthy.Load() || !s.policy.shouldRestart(record) {
+		return
+	}
+
+	s.mu.Lock()
+	if s.recovering || s.crashLoop != "" {
+		s.mu.Unlock()
+		return
+	}
+	s.recovering = true
+	// 稳定运行一段时间后才退出，不算连续崩溃
+	if record.Uptime >= stableUptime {
+		s.attempts = 0
+	}
+	s.mu.Unlock()
+
+	go s.recover(record)
+}
+
+// recover 按退避时间重启进程，直到健康检查通过或连续重启次数超过上限
+func (s *supervisor) recover(record *ExitRecord) {
+	logger := GetLogger()
+	defer func() {
+		s.mu.Lock()
+		s.recovering = false
+		s.mu.Unlock()
+	}()
+
+	reason := record.Cause()
+	for {
+		s.mu.Lock()
+		s.attempts++
+		attempt := s.attempts
+		s.mu.Unlock()
+
+		if attempt > s.policy.MaxRetries {
+			s.giveUp(reason)
+			return
+		}
+
+		delay := s.policy.delay(attempt)
+		logger.Info("进程 %s 意外退出（%s），%v 后第 %d 次重启", s.name, reason, delay, attempt)
+		processEvents.Emit(ProcessEvent{
+			Type:    EventRestarting,
+			Process: s.name,
+			Message: fmt.Sprintf("进程 %s 意外退出（%s），%v 后第 %d 次重启", s.name, reason, delay, attempt),
+			Level:   "warning",
+			Data: map[string]any{
+				"attempt":  attempt,
+				"delay_ms": delay.Milliseconds(),
+				"reason":   reason,
+			},
+		})
+
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(delay):
+		}
+
+		entry := RestartRecord{Attempt: attempt, Time: time.Now(), Reason: reason, Delay: delay}
+		healthy, output, ok := s.restart(s.stop)
+		if !ok {
+			return
+		}
+		entry.Healthy = healthy
+		if !healthy {
+			entry.Output = output
+		}
+		s.addHistory(entry)
+
+		if healthy {
+			logger.Info("进程 %s 第 %d 次重启成功", s.name, attempt)
+			return
+		}
+		logger.Error("进程 %s 第 %d 次重启失败", s.name, attempt)
+		reason = "重启后健康检查未通过"
+	}
+}
+
+// giveUp 连续重启次数超过上限，判定为崩溃循环并停止重启
+func (s *supervisor) giveUp(reason string) {
+	s.mu.Lock()
+	s.crashLoop = fmt.Sprintf("进程 %s 连续重启 %d 次仍未稳定运行（最后一次: %s），判定为崩溃循环，已停止自动重启",
+		s.name, s.policy.MaxRetries, reason)
+	report := s.crashLoop
+	s.mu.Unlock()
+
+	GetLogger().Error("%s", report)
+	processEvents.Emit(ProcessEvent{
+		Type:    EventCrashLoop,
+		Process: s.name,
+		Message: report,
+		Level:   "error",
+		Data: map[string]any{
+			"max_retries": s.policy.MaxRetries,
+			"reason":      reason,
+		},
+	})
+}
+
+// addHistory 记录一次重启，只保留最近的记录
+func (s *supervisor) addHistory(entry RestartRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = append(s.history, entry)
+	if len(s.history) > restartHistorySize {
+		s.history = s.history[len(s.history)-restartHistorySize:]
+	}
+}
+
+// SupervisorStatus 重启策略的执行状态（用于 get_restart_history 和 list_processes）
+type SupervisorStatus struct {
+	Policy     RestartPolicy
+	Attempts   int
+	Recovering bool
+	CrashLoop  string
+	History    []RestartRecord
+}
+
+// GetSupervisorStatus 获取进程的重启策略执行状态
+func (pm *ProcessManager) GetSupervisorStatus(name string) (SupervisorStatus, bool) {
+	s, ok := pm.getSupervisor(name)
+	if !ok {
+		return SupervisorStatus{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SupervisorStatus{
+		Policy:     *s.policy,
+		Attempts:   s.attempts,
+		Recovering: s.recovering,
+		CrashLoop:  s.crashLoop,
+		History:    append([]RestartRecord(nil), s.history...),
+	}, true
+}
+
+// Report 重启策略状态的文字报告，重启记录最新的在前
+func (st SupervisorStatus) Report(name string) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("进程 %s 的重启策略: %s\n", name, st.Policy.String()))
+	switch {
+	case st.CrashLoop != "":
+		builder.WriteString("⚠️ " + st.CrashLoop + "\n")
+		builder.WriteString("提示：使用 get_exit_report 查看最后一次退出前的日志，修复后用 restart_process 重启\n")
+	case st.Recovering:
+		builder.WriteString(fmt.Sprintf("状态: 正在重启（第 %d 次）\n", st.Attempts))
+	default:
+		builder.WriteString(fmt.Sprintf("状态: 监督中（当前连续重启 %d 次）\n", st.Attempts))
+	}
+
+	if len(st.History) == 0 {
+		builder.WriteString("\n尚未自动重启过。\n")
+		return builder.String()
+	}
+	builder.WriteString(fmt.Sprintf("\n最近 %d 次自动重启:\n", len(st.History)))
+	for i := len(st.History) - 1; i >= 0; i-- {
+		entry := st.History[i]
+		result := "健康检查通过"
+		if !entry.Healthy {
+			result = "启动失败"
+		}
+		builder.WriteString(fmt.Sprintf("- %s 第 %d 次（等待 %v）: %s，原因: %s\n",
+			entry.Time.Format("15:04:05"), entry.Attempt, entry.Delay, result, entry.Reason))
+	}
+	// 最近一次失败的完整启动结果
+	for i := len(st.History) - 1; i >= 0; i-- {
+		if !st.History[i].Healthy {
+			builder.WriteString(fmt.Sprintf("\n最近一次重启失败的结果（第 %d 次）:\n%s\n", st.History[i].Attempt, st.History[i].Output))
+			break
+		}
+	}
+	return builder.String()
+}
+
+// structured 重启策略状态的结构化形式
+func (st SupervisorStatus) structured(name string) map[string]any {
+	history := make([]map[string]any, 0, len(st.History))
+	for i := len(st.History) - 1; i >= 0; i-- {
+		entry := st.History[i]
+		item := map[string]any{
+			"attempt":  entry.Attempt,
+			"time":     entry.Time.Format(time.RFC3339),
+			"reason":   entry.Reason,
+			"delay_ms": entry.Delay.Milliseconds(),
+			"healthy":  entry.Healthy,
+		}
+		if entry.Output != "" {
+			item["output"] = entry.Output
+		}
+		history = append(history, item)
+	}
+	return map[string]any{
+		"name":        name,
+		"policy":      st.Policy.Mode,
+		"max_retries": st.Policy.MaxRetries,
+		"backoff_ms":  st.Policy.Backoff.Milliseconds(),
+		"attempts":    st.Attempts,
+		"recovering":  st.Recovering,
+		"crash_loop":  st.CrashLoop != "",
+		"restarts":    history,
+	}
+}
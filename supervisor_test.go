@@ -0,0 +1,195 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewRestartPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		mode      string
+		retries   int
+		backoffMs int
+		want      *RestartPolicy
+		wantErr   bool
+	}{
+		{"", 0, 0, nil, false},
+		{"never", 3, 100, nil, false},
+		{"on-failure", 0, 0, &RestartPolicy{Mode: RestartOnFailure, MaxRetries: defaultMaxRestarts, Backoff: defaultRestartBackoff}, false},
+		{" Always ", 2, 250, &RestartPolicy{Mode: RestartAlways, MaxRetries: 2, Backoff: 250 * time.Millisecond}, false},
+		{"sometimes", 0, 0, nil, true},
+	} {
+		got, err := newRestartPolicy(tc.mode, tc.retries, tc.backoffMs)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("newRestartPolicy(%q) error = %v, want error %v", tc.mode, err, tc.wantErr)
+			continue
+		}
+		if (got == nil) != (tc.want == nil) || got != nil && *got != *tc.want {
+			t.Errorf("newRestartPolicy(%q) = %+v, want %+v", tc.mode, got, tc.want)
+		}
+	}
+}
+
+func TestRestartPolicyDelay(t *testing.T) {
+	for _, tc := range []struct {
+		backoff time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{time.Second, 1, time.Second},
+		{time.Second, 2, 2 * time.Second},
+		{time.Second, 3, 4 * time.Second},
+		{time.Second, 5, 16 * time.Second},
+		// 翻倍到上限后不再增长
+		{time.Second, 6, maxRestartBackoff},
+		{time.Second, 50, maxRestartBackoff},
+		{20 * time.Second, 1, 20 * time.Second},
+		{20 * time.Second, 2, maxRestartBackoff},
+		{time.Minute, 1, maxRestartBackoff},
+	} {
+		p := &RestartPolicy{Mode: RestartAlways, MaxRetries: 5, Backoff: tc.backoff}
+		if got := p.delay(tc.attempt); got != tc.want {
+			t.Errorf("delay(%d) with backoff %v = %v, want %v", tc.attempt, tc.backoff, got, tc.want)
+		}
+	}
+}
+
+func TestRestartPolicyShouldRestart(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		mode   string
+		record *ExitRecord
+		want   bool
+	}{
+		{"on-failure non-zero exit", RestartOnFailure, &ExitRecord{ExitCode: 1}, true},
+		{"on-failure killed by signal", RestartOnFailure, &ExitRecord{ExitCode: -1, Signal: "killed"}, true},
+		{"on-failure clean exit", RestartOnFailure, &ExitRecord{ExitCode: 0}, false},
+		{"on-failure expected exit", RestartOnFailure, &ExitRecord{ExitCode: 1, Expected: true}, false},
+		{"always clean exit", RestartAlways, &ExitRecord{ExitCode: 0}, true},
+		{"always non-zero exit", RestartAlways, &ExitRecord{ExitCode: 2}, true},
+		{"always expected exit", RestartAlways, &ExitRecord{ExitCode: 0, Expected: true}, false},
+	} {
+		p := &RestartPolicy{Mode: tc.mode, MaxRetries: 5, Backoff: time.Second}
+		if got := p.shouldRestart(tc.record); got != tc.want {
+			t.Errorf("%s: shouldRestart = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// testSupervisor 注册一个退避很短的监督者，restart 按 results 依次返回健康检查结果，之后一直失败
+func testSupervisor(pm *ProcessManager, name string, maxRetries int, results ...bool) *int {
+	calls := new(int)
+	policy := &RestartPolicy{Mode: RestartOnFailure, MaxRetries: maxRetries, Backoff: time.Millisecond}
+	pm.StartSupervisor(name, policy, func(stop <-chan struct{}) (bool, string, bool) {
+		*calls++
+		healthy := *calls <= len(results) && results[*calls-1]
+		return healthy, "启动失败", true
+	})
+	return calls
+}
+
+// waitRecovered 等待监督者处理完一次退出
+func waitRecovered(t *testing.T, pm *ProcessManager, name string) SupervisorStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, _ := pm.GetSupervisorStatus(name)
+		if !status.Recovering {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("进程 %s 的重启未在 5 秒内结束", name)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSupervisorGivesUpAfterMaxRetries(t *testing.T) {
+	pm := &ProcessManager{}
+	calls := testSupervisor(pm, "api", 3)
+	defer pm.StopSupervisor("api")
+
+	s, _ := pm.getSupervisor("api")
+	s.recover(&ExitRecord{ExitCode: 1})
+
+	status, _ := pm.GetSupervisorStatus("api")
+	if *calls != 3 {
+		t.Errorf("restart called %d times, want 3", *calls)
+	}
+	if status.CrashLoop == "" {
+		t.Error("CrashLoop is empty, want a crash loop report")
+	}
+	if len(status.History) != 3 {
+		t.Fatalf("history has %d entries, want 3", len(status.History))
+	}
+	for i, entry := range status.History {
+		if entry.Attempt != i+1 || entry.Healthy || entry.Output == "" {
+			t.Errorf("history[%d] = %+v, want failed attempt %d with output", i, entry, i+1)
+		}
+	}
+	if status.History[1].Reason != "重启后健康检查未通过" {
+		t.Errorf("second attempt reason = %q", status.History[1].Reason)
+	}
+
+	// 判定为崩溃循环后不再处理退出
+	info := &ProcessInfo{Name: "api"}
+	info.healthy.Store(true)
+	pm.superviseExit(info, &ExitRecord{ExitCode: 1})
+	if waitRecovered(t, pm, "api"); *calls != 3 {
+		t.Errorf("restart called %d times after crash loop, want 3", *calls)
+	}
+}
+
+func TestSupervisorStopsAfterHealthyRestart(t *testing.T) {
+	pm := &ProcessManager{}
+	calls := testSupervisor(pm, "api", 5, false, true)
+	defer pm.StopSupervisor("api")
+
+	s, _ := pm.getSupervisor("api")
+	s.recover(&ExitRecord{ExitCode: 1})
+
+	status, _ := pm.GetSupervisorStatus("api")
+	if *calls != 2 || status.Attempts != 2 || status.CrashLoop != "" {
+		t.Errorf("calls %d, attempts %d, crash loop %q, want 2 restarts and no crash loop", *calls, status.Attempts, status.CrashLoop)
+	}
+	if len(status.History) != 2 || !status.History[1].Healthy || status.History[1].Output != "" {
+		t.Errorf("history = %+v, want the second restart healthy without output", status.History)
+	}
+}
+
+func TestSuperviseExit(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		healthy      bool
+		record       *ExitRecord
+		attempts     int // 退出前已连续重启的次数
+		wantCalls    int
+		wantAttempts int
+	}{
+		{"unexpected exit", true, &ExitRecord{ExitCode: 1, Uptime: time.Second}, 0, 1, 1},
+		{"consecutive crash keeps counting", true, &ExitRecord{ExitCode: 1, Uptime: time.Second}, 2, 1, 3},
+		// 稳定运行后退出，重新计算连续重启次数
+		{"exit after stable uptime resets attempts", true, &ExitRecord{ExitCode: 1, Uptime: stableUptime}, 4, 1, 1},
+		{"expected exit", true, &ExitRecord{ExitCode: 1, Expected: true}, 0, 0, 0},
+		{"clean exit under on-failure", true, &ExitRecord{ExitCode: 0}, 0, 0, 0},
+		// 从未通过健康检查的进程由启动它的工具调用报告，不自动重启
+		{"never healthy", false, &ExitRecord{ExitCode: 1}, 0, 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pm := &ProcessManager{}
+			calls := testSupervisor(pm, "api", 5, true)
+			defer pm.StopSupervisor("api")
+			s, _ := pm.getSupervisor("api")
+			s.attempts = tc.attempts
+
+			info := &ProcessInfo{Name: "api"}
+			info.healthy.Store(tc.healthy)
+			pm.superviseExit(info, tc.record)
+			status := waitRecovered(t, pm, "api")
+
+			if *calls != tc.wantCalls || status.Attempts != tc.wantAttempts {
+				t.Errorf("calls %d, attempts %d, want %d and %d", *calls, status.Attempts, tc.wantCalls, tc.wantAttempts)
+			}
+		})
+	}
+}
@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -39,32 +42,67 @@ func releaseToolSemaphore() {
 	GetLogger().Info("[Semaphore] 已释放信号量")
 }
 
+// defaultCorrelationHeader request_with_logs 默认注入的请求ID头
+const defaultCorrelationHeader = "X-Request-Id"
+
 // RegisterTools 注册所有 MCP 工具
 func RegisterTools(server *mcp.Server) {
 	logger := GetLogger()
 
 	// 注册 start_process 工具：启动进程并收集日志
 	type startProcessArgs struct {
-		Name              string            `json:"name" jsonschema:"进程名称，用于后续操作该进程"`
-		Command           string            `json:"command" jsonschema:"要执行的命令"`
-		Args              []string          `json:"args,omitempty" jsonschema:"命令参数列表"`
-		WorkDir           string            `json:"work_dir,omitempty" jsonschema:"工作目录，默认为命令文件所在目录"`
-		Env               map[string]string `json:"env,omitempty" jsonschema:"环境变量，键值对形式"`
-		HealthCheckURL    string            `json:"health_check_url" jsonschema:"健康检查接口URL，接口返回2xx状态码视为启动成功"`
-		TimeoutSeconds    int               `json:"timeout_seconds,omitempty" jsonschema:"等待启动超时时间（秒），默认60秒"`
-		HealthCheckMethod string            `json:"health_check_method,omitempty" jsonschema:"健康检查请求方法，默认GET"`
+		Name string `json:"name" jsonschema:"进程名称，用于后续操作该进程；与工作目录下 .gomcp.json 中的服务同名且未传 command 时，未传入的参数使用该服务的配置（传入 command 时完全按传入的参数启动）"`
+		launchArgs
+		LogStream        string `json:"log_stream,omitempty" jsonschema:"启动日志显示方式：不填返回原始日志；all 为每行标记时间和来源；stdout/stderr 只返回对应流"`
+		MinLevel         string `json:"min_level,omitempty" jsonschema:"启动日志只返回不低于该级别的日志：trace/debug/info/warn/error/fatal（无法识别级别的行默认不返回，见 include_unleveled）"`
+		IncludeUnleveled bool   `json:"include_unleveled,omitempty" jsonschema:"设置 min_level 时仍返回无法识别级别的行（如没有级别标记的 fmt.Println 输出）"`
+		LogFormat        string `json:"log_format,omitempty" jsonschema:"启动日志显示格式：raw（默认，原始行）或 compact（JSON日志显示为 级别 消息 key=value 的紧凑形式）"`
+		StopGraceSeconds int    `json:"stop_grace_seconds,omitempty" jsonschema:"已有同名进程时，先发送 SIGTERM（Windows 为 CTRL_BREAK）等待其优雅退出的秒数，超时后强制终止，默认5秒"`
 	}
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "start_process",
-		Description: "启动一个进程并收集其所有日志，通过调用健康检查接口确认启动成功，支持设置环境变量和工作目录。注意：command 应该是可执行文件名（如 'go', 'python', 'node'），实际的命令参数应该放在 args 中（如 ['run', '.']）",
+		Description: "启动一个进程并收集其所有日志，通过调用健康检查接口确认启动成功，支持设置环境变量和工作目录。注意：command 应该是可执行文件名（如 'go', 'python', 'node'），实际的命令参数应该放在 args 中（如 ['run', '.']）。工作目录（work_dir，默认当前目录）下的 .gomcp.json 定义了服务时，只传 name 即可按配置启动（用 list_services 查看）",
 	}, func(ctx context.Context, _ *mcp.CallToolRequest, args startProcessArgs) (*mcp.CallToolResult, any, error) {
 		// 获取工具执行权限，确保工具串行执行
 		acquireToolSemaphore()
 		defer releaseToolSemaphore()
 
-		timeout := time.Duration(args.TimeoutSeconds) * time.Second
-		if timeout == 0 {
-			timeout = 60 * time.Second
+		// 项目配置中定义了同名服务时，未传入的参数使用配置中的值
+		service, config, found, err := findService(args.Name, args.WorkDir)
+		if err != nil {
+			logger.Error("加载项目配置失败: %v", err)
+		}
+		// 传入了完整参数时不依赖配置文件，配置有误也照常启动
+		if err != nil && args.Command == "" {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: err.Error()},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+		// 传入了 command 时完全按传入的参数启动，不合并配置中的任何字段，并在结果中说明
+		var configNote string
+		switch {
+		case err != nil:
+			configNote = fmt.Sprintf("\n注意: 项目配置加载失败，已按传入的参数启动: %v\n", err)
+		case found && args.Command != "":
+			logger.Info("传入了 command，不使用项目配置 %s 中的服务 %s", config.Path, args.Name)
+			configNote = fmt.Sprintf("\n注意: 传入了 command，未使用项目配置 %s 中的服务 '%s'（env、health_check_url 等配置项均未生效），只传 name 即可按配置启动\n", config.Path, args.Name)
+		case found:
+			logger.Info("使用项目配置 %s 中的服务 %s", config.Path, args.Name)
+			service.applyTo(&args.launchArgs, filepath.Dir(config.Path))
+			if args.StopGraceSeconds == 0 {
+				args.StopGraceSeconds = service.StopGraceSeconds
+			}
+		}
+		if args.Command == "" || (args.HealthCheckURL == "" && args.Readiness == nil) {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("参数错误：必须提供 command，以及 health_check_url 或 readiness%s", serviceHint(args.Name, config))},
+				},
+				IsError: true,
+			}, nil, nil
 		}
 
 		logger.Info("=== 开始启动进程 ===")
@@ -84,83 +122,309 @@ func RegisterTools(server *mcp.Server) {
 			}, nil, nil
 		}
 
-		// 如果之前有同名进程在运行，先清理它
-		if oldProcess, exists := processManager.GetProcess(args.Name); exists {
-			logger.Info("发现同名进程 %s (PID: %d) 仍在运行，先清理...", args.Name, oldProcess.Cmd.Process.Pid)
-			if err := processManager.KillProcess(args.Name); err != nil {
-				logger.Error("清理旧进程失败: %v", err)
+		logView, err := parseLogView(args.LogStream, args.MinLevel, args.IncludeUnleveled, args.LogFormat)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("参数错误：%v", err)},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+		spec, err := args.launchSpec(args.Name)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("参数错误：%v", err)},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+		result := launchProcess(ctx, spec, logView, stopGrace(args.StopGraceSeconds, false))
+		superviseLaunch(spec, result)
+		if text, ok := result.Content[0].(*mcp.TextContent); ok && configNote != "" {
+			text.Text += configNote
+		}
+		return result, nil, nil
+	})
+
+	// 注册 restart_process 工具：按原启动参数重启进程
+	type restartProcessArgs struct {
+		Name             string            `json:"name" jsonschema:"进程名称，必须是本mcp启动过的进程（已被 kill_process 终止的也可以）"`
+		Env              map[string]string `json:"env,omitempty" jsonschema:"额外的环境变量，与原启动参数中的环境变量合并（同名覆盖），会保留到之后的重启"`
+		Args             []string          `json:"args,omitempty" jsonschema:"替换原命令参数，不填则沿用原参数"`
+		TimeoutSeconds   int               `json:"timeout_seconds,omitempty" jsonschema:"等待启动超时时间（秒），不填则沿用原参数"`
+		StopGraceSeconds int               `json:"stop_grace_seconds,omitempty" jsonschema:"先发送 SIGTERM（Windows 为 CTRL_BREAK）等待旧进程优雅退出的秒数，超时后强制终止，默认5秒"`
+		LogStream        string            `json:"log_stream,omitempty" jsonschema:"启动日志显示方式：不填返回原始日志；all 为每行标记时间和来源；stdout/stderr 只返回对应流"`
+		MinLevel         string            `json:"min_level,omitempty" jsonschema:"启动日志只返回不低于该级别的日志：trace/debug/info/warn/error/fatal（无法识别级别的行默认不返回，见 include_unleveled）"`
+		IncludeUnleveled bool              `json:"include_unleveled,omitempty" jsonschema:"设置 min_level 时仍返回无法识别级别的行（如没有级别标记的 fmt.Println 输出）"`
+		LogFormat        string            `json:"log_format,omitempty" jsonschema:"启动日志显示格式：raw（默认，原始行）或 compact（JSON日志显示为 级别 消息 key=value 的紧凑形式）"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "restart_process",
+		Description: "按 start_process 时的原始参数（命令、参数、环境变量、工作目录、健康检查）重启本mcp启动过的进程，无需重新传入全部参数。可以追加环境变量或替换命令参数，健康检查方式与 start_process 相同，返回新进程的启动日志。修改代码后重启服务时优先使用此工具。",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, args restartProcessArgs) (*mcp.CallToolResult, any, error) {
+		// 获取工具执行权限，确保工具串行执行
+		acquireToolSemaphore()
+		defer releaseToolSemaphore()
+
+		logger.Info("=== 开始重启进程 ===")
+		logger.Info("进程名称: %s", args.Name)
+
+		spec, ok := processManager.GetLaunchSpec(args.Name)
+		if !ok {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("未找到进程 '%s' 的启动参数\n提示：本 mcp 未启动过此进程，请先使用 start_process 启动", args.Name)},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+
+		logView, err := parseLogView(args.LogStream, args.MinLevel, args.IncludeUnleveled, args.LogFormat)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("参数错误：%v", err)},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+
+		// 应用覆盖参数
+		if len(args.Env) > 0 {
+			if spec.Env == nil {
+				spec.Env = make(map[string]string, len(args.Env))
 			}
-			// 等待一下让端口释放
-			time.Sleep(1 * time.Second)
+			for key, value := range args.Env {
+				spec.Env[key] = value
+			}
+		}
+		if len(args.Args) > 0 {
+			spec.Args = args.Args
+		}
+		if args.TimeoutSeconds > 0 {
+			spec.Timeout = time.Duration(args.TimeoutSeconds) * time.Second
+		}
+
+		logger.Info("命令: %s %v", spec.Command, spec.Args)
+		logger.Info("工作目录: %s", spec.WorkDir)
+		logger.Info("健康检查: %s", spec.HealthCheckURL)
+
+		result := launchProcess(ctx, spec, logView, stopGrace(args.StopGraceSeconds, false))
+
+		// 进程被 kill_process 终止时监听已停止，按原参数恢复监听
+		if _, watching := processManager.getWatcher(spec.Name); spec.Watch != nil && !watching {
+			startSourceWatch(spec, result)
+		}
+		// 重启策略同理；已判定为崩溃循环时手动重启后重新开始监督
+		if status, supervising := processManager.GetSupervisorStatus(spec.Name); spec.Restart != nil && (!supervising || status.CrashLoop != "") {
+			startSupervisor(spec, result)
 		}
+		return result, nil, nil
+	})
+
+	// 注册 start_stack 工具：按依赖顺序启动一组服务
+	type stackServiceArgs struct {
+		Name string `json:"name" jsonschema:"服务（进程）名称，之后可用 get_logs、request_with_logs 等工具按此名称操作"`
+		launchArgs
+		DependsOn []string `json:"depends_on,omitempty" jsonschema:"依赖的服务名称，这些服务健康检查通过后才启动本服务"`
+	}
+	type startStackArgs struct {
+		Name             string             `json:"name" jsonschema:"服务组名称，用于 stop_stack"`
+		Services         []stackServiceArgs `json:"services" jsonschema:"服务列表，按 depends_on 排序后依次启动"`
+		StopGraceSeconds int                `json:"stop_grace_seconds,omitempty" jsonschema:"已有同名进程时，先发送 SIGTERM（Windows 为 CTRL_BREAK）等待其优雅退出的秒数，默认5秒"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "start_stack",
+		Description: "一次启动多个相互依赖的服务（如 API、worker、mock 认证服务）。按 depends_on 排序后依次启动，每个服务健康检查通过后再启动依赖它的服务；某个服务启动失败时跳过依赖它的服务，返回每个服务的结果和失败服务的日志。用 stop_stack 按相反顺序停止。",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, args startStackArgs) (*mcp.CallToolResult, any, error) {
+		// 获取工具执行权限，确保工具串行执行
+		acquireToolSemaphore()
+		defer releaseToolSemaphore()
 
-		// 检查端口是否被其他进程占用（非本MCP启动的进程），如果是则尝试清理
-		// 注意：只有在端口确实被占用时才会执行清理
-		if err := KillProcessByHealthCheckURL(args.HealthCheckURL); err != nil {
-			// 端口未被占用或清理失败都不算严重错误
-			logger.Debug("端口检查: %v", err)
+		logger.Info("=== 开始启动服务组: %s ===", args.Name)
+
+		if args.Name == "" {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: "参数错误：必须提供服务组名称 name"},
+				},
+				IsError: true,
+			}, nil, nil
 		}
 
-		processInfo, err := processManager.StartProcess(args.Name, args.Command, args.Args, args.Env, args.WorkDir, args.HealthCheckURL, timeout)
+		// 启动任何服务之前校验所有服务的参数，参数错误时不启动任何服务
+		services := make([]StackService, 0, len(args.Services))
+		for _, service := range args.Services {
+			spec, err := service.launchSpec(service.Name)
+			if err != nil {
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{
+						&mcp.TextContent{Text: fmt.Sprintf("参数错误：服务 '%s': %v", service.Name, err)},
+					},
+					IsError: true,
+				}, nil, nil
+			}
+			services = append(services, StackService{Spec: spec, DependsOn: service.DependsOn})
+		}
+		ordered, err := orderStackServices(services)
 		if err != nil {
-			logger.Error("启动进程失败: %v", err)
 			return &mcp.CallToolResult{
 				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("启动进程失败: %v", err)},
+					&mcp.TextContent{Text: fmt.Sprintf("参数错误：%v", err)},
 				},
 				IsError: true,
 			}, nil, nil
 		}
 
-		// 启动健康检查（优先使用端口检查，同时监控进程退出）
-		var healthCheckErr error
-		if processInfo.HealthCheckPort > 0 {
-			// 使用端口检查（更快，无需 HTTP），同时监控进程退出
-			logger.Info("使用端口检查: %d", processInfo.HealthCheckPort)
-			healthCheckErr = waitForPortReadyWithExitCheck(processInfo.HealthCheckPort, timeout, processInfo.ExitChan)
-		} else {
-			// 回退到 HTTP URL 检查，同时监控进程退出
-			logger.Info("使用 HTTP URL 检查: %s", args.HealthCheckURL)
-			healthCheckErr = waitForHTTPReadyWithExitCheck(ctx, args.HealthCheckURL, args.HealthCheckMethod, timeout, processInfo.ExitChan)
+		stack := Stack{Name: args.Name}
+		for _, service := range ordered {
+			stack.Order = append(stack.Order, service.Spec.Name)
+		}
+		// 先记录服务组，部分服务启动失败时也能用 stop_stack 清理
+		processManager.SaveStack(stack)
+		logger.Info("服务组 %s 启动顺序: %s", args.Name, strings.Join(stack.Order, " -> "))
+
+		start := time.Now()
+		grace := stopGrace(args.StopGraceSeconds, false)
+		failed := make(map[string]bool)
+		steps := make([]StackStep, 0, len(ordered))
+		var failures strings.Builder
+		for _, service := range ordered {
+			name := service.Spec.Name
+			var failedDeps []string
+			for _, dep := range service.DependsOn {
+				if failed[dep] {
+					failedDeps = append(failedDeps, dep)
+				}
+			}
+			if len(failedDeps) > 0 {
+				failed[name] = true
+				steps = append(steps, StackStep{
+					Service: name,
+					Skipped: true,
+					Detail:  fmt.Sprintf("依赖的服务 %s 未启动，已跳过", strings.Join(failedDeps, ", ")),
+				})
+				continue
+			}
+
+			result := launchProcess(ctx, service.Spec, LogView{}, grace)
+			// 与 start_process 相同：按服务的参数开始或停止重启策略和源码监听
+			superviseLaunch(service.Spec, result)
+			step := StackStep{Service: name, OK: !result.IsError}
+			if text, ok := result.Content[0].(*mcp.TextContent); ok {
+				step.Detail = text.Text
+			}
+			if !step.OK {
+				failed[name] = true
+				failures.WriteString(fmt.Sprintf("\n=== %s ===\n%s\n", name, step.Detail))
+			} else if info, ok := processManager.GetProcess(name); ok {
+				probe, _ := newReadinessProbe(service.Spec)
+				step.Detail = fmt.Sprintf("已启动 (PID: %d)，已就绪: %s", info.Cmd.Process.Pid, probe.Describe())
+			}
+			steps = append(steps, step)
 		}
 
-		if healthCheckErr != nil {
-			// 超时后终止进程
-			processManager.KillProcess(args.Name)
-			logger.Error("进程 %s 启动失败: %v", args.Name, healthCheckErr)
+		title := fmt.Sprintf("服务组 %s 已全部启动", args.Name)
+		if len(failed) > 0 {
+			title = fmt.Sprintf("服务组 %s 部分服务启动失败（已启动的服务仍在运行，可用 stop_stack 停止）", args.Name)
+		}
+		text := stackReport(title, steps, time.Since(start))
+		if failures.Len() > 0 {
+			text += "\n启动失败的服务:\n" + failures.String()
+		}
+		return &mcp.CallToolResult{
+			StructuredContent: map[string]any{
+				"stack":    args.Name,
+				"order":    stack.Order,
+				"ok":       len(failed) == 0,
+				"services": structuredStackSteps(steps),
+			},
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: text},
+			},
+			IsError: len(failed) > 0,
+		}, nil, nil
+	})
+
+	// 注册 stop_stack 工具：按启动的相反顺序停止服务组
+	type stopStackArgs struct {
+		Name         string `json:"name" jsonschema:"start_stack 时的服务组名称"`
+		GraceSeconds int    `json:"grace_seconds,omitempty" jsonschema:"每个服务先发送 SIGTERM（Windows 为 CTRL_BREAK）等待其优雅退出的秒数，超时后强制终止，默认5秒"`
+		Force        bool   `json:"force,omitempty" jsonschema:"跳过优雅退出，直接强制终止"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "stop_stack",
+		Description: "停止 start_stack 启动的服务组：按启动顺序的相反顺序（先停依赖方，再停被依赖的服务）逐个终止，返回每个服务在哪个阶段结束。",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, args stopStackArgs) (*mcp.CallToolResult, any, error) {
+		// 获取工具执行权限，确保工具串行执行
+		acquireToolSemaphore()
+		defer releaseToolSemaphore()
+
+		logger.Info("=== 开始停止服务组: %s ===", args.Name)
+
+		stack, ok := processManager.GetStack(args.Name)
+		if !ok {
 			return &mcp.CallToolResult{
 				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("进程启动失败\nPID: %d\n健康检查URL: %s\n错误: %v\n\n已收集日志:\n%s",
-						processInfo.Cmd.Process.Pid,
-						args.HealthCheckURL,
-						healthCheckErr,
-						processInfo.LogBuffer.String())},
+					&mcp.TextContent{Text: fmt.Sprintf("未找到服务组 '%s'\n提示：只能停止本 mcp 用 start_stack 启动的服务组", args.Name)},
 				},
 				IsError: true,
 			}, nil, nil
 		}
 
-		logs := processInfo.LogBuffer.String()
-		logger.Info("进程 %s 启动成功", args.Name)
+		start := time.Now()
+		grace := stopGrace(args.GraceSeconds, args.Force)
+		steps := make([]StackStep, 0, len(stack.Order))
+		hasError := false
+		for i := len(stack.Order) - 1; i >= 0; i-- {
+			name := stack.Order[i]
+			processManager.StopWatch(name)
+			processManager.StopSupervisor(name)
+
+			if _, running := processManager.GetProcess(name); !running {
+				steps = append(steps, StackStep{Service: name, OK: true, Skipped: true, Detail: "未在运行"})
+				continue
+			}
+			stopResult, err := processManager.KillProcess(name, grace)
+			if err != nil {
+				hasError = true
+				steps = append(steps, StackStep{Service: name, Detail: fmt.Sprintf("终止失败: %v", err)})
+				continue
+			}
+			steps = append(steps, StackStep{Service: name, OK: true, Detail: stopResult.Describe()})
+		}
+		processManager.RemoveStack(args.Name)
+
 		return &mcp.CallToolResult{
+			StructuredContent: map[string]any{
+				"stack":    args.Name,
+				"ok":       !hasError,
+				"services": structuredStackSteps(steps),
+			},
 			Content: []mcp.Content{
-				&mcp.TextContent{Text: fmt.Sprintf("进程已成功启动\nPID: %d\n启动时间: %s\n工作目录: %s\n健康检查: %s\n\n启动日志:\n%s",
-					processInfo.Cmd.Process.Pid,
-					processInfo.StartTime.Format(time.RFC3339),
-					processInfo.Cmd.Dir,
-					args.HealthCheckURL,
-					logs)},
+				&mcp.TextContent{Text: stackReport(fmt.Sprintf("服务组 %s 已停止", args.Name), steps, time.Since(start))},
 			},
+			IsError: hasError,
 		}, nil, nil
 	})
 
 	// 注册 request_with_logs 工具：发起HTTP请求并获取日志
 	type requestWithLogsArgs struct {
-		ProcessName string            `json:"process_name,omitempty" jsonschema:"进程名称（可选），如果提供则使用该进程的host和port替换URL中的host和port"`
-		URL         string            `json:"url" jsonschema:"要请求的URL，可以是完整URL或路径"`
-		Method      string            `json:"method,omitempty" jsonschema:"HTTP方法，默认GET"`
-		Headers     map[string]string `json:"headers,omitempty" jsonschema:"HTTP请求头"`
-		Body        string            `json:"body,omitempty" jsonschema:"请求体内容"`
+		ProcessName       string            `json:"process_name,omitempty" jsonschema:"进程名称（可选），如果提供则使用该进程的host和port替换URL中的host和port"`
+		URL               string            `json:"url" jsonschema:"要请求的URL，可以是完整URL或路径"`
+		Method            string            `json:"method,omitempty" jsonschema:"HTTP方法，默认GET"`
+		Headers           map[string]string `json:"headers,omitempty" jsonschema:"HTTP请求头"`
+		Body              string            `json:"body,omitempty" jsonschema:"请求体内容"`
+		LogStream         string            `json:"log_stream,omitempty" jsonschema:"进程日志显示方式：不填返回原始日志；all 为每行标记时间和来源；stdout/stderr 只返回对应流（如只看 stderr 中的 panic 和警告）"`
+		MinLevel          string            `json:"min_level,omitempty" jsonschema:"只返回不低于该级别的进程日志：trace/debug/info/warn/error/fatal（JSON日志取level字段，纯文本按行首的级别标记或 level=xxx 识别，无法识别级别的行默认不返回，见 include_unleveled）"`
+		IncludeUnleveled  bool              `json:"include_unleveled,omitempty" jsonschema:"设置 min_level 时仍返回无法识别级别的行（如没有级别标记的 fmt.Println 输出）"`
+		LogFormat         string            `json:"log_format,omitempty" jsonschema:"进程日志显示格式：raw（默认，原始行）或 compact（JSON日志显示为 级别 消息 key=value 的紧凑形式）"`
+		CorrelationHeader string            `json:"correlation_header,omitempty" jsonschema:"注入请求ID的请求头名称，默认X-Request-Id；服务在日志中输出该ID时可精确获取本次请求的日志；设为 none 则不注入，只按时间窗口获取日志"`
+		SettleQuietMs     int               `json:"settle_quiet_ms,omitempty" jsonschema:"请求返回后继续收集日志，直到进程静默该毫秒数（用于捕获异步任务的日志）"`
+		SettlePattern     string            `json:"settle_pattern,omitempty" jsonschema:"请求返回后继续收集日志，直到出现匹配该正则的日志行"`
+		SettleMaxMs       int               `json:"settle_max_ms,omitempty" jsonschema:"继续收集日志的最长时间（毫秒），默认10000，仅在设置了 settle_quiet_ms 或 settle_pattern 时生效"`
 	}
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "request_with_logs",
@@ -175,6 +439,35 @@ func RegisterTools(server *mcp.Server) {
 		logger.Info("方法: %s", args.Method)
 		logger.Info("URL: %s", args.URL)
 
+		logView, err := parseLogView(args.LogStream, args.MinLevel, args.IncludeUnleveled, args.LogFormat)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("参数错误：%v", err)},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+
+		// 解析日志等待策略
+		settlePolicy := SettlePolicy{
+			Quiet: time.Duration(args.SettleQuietMs) * time.Millisecond,
+			Max:   time.Duration(args.SettleMaxMs) * time.Millisecond,
+		}
+		if settlePolicy.Max <= 0 {
+			settlePolicy.Max = 10 * time.Second
+		}
+		if args.SettlePattern != "" {
+			if settlePolicy.Pattern, err = regexp.Compile(args.SettlePattern); err != nil {
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{
+						&mcp.TextContent{Text: fmt.Sprintf("参数错误：settle_pattern 正则无效: %v", err)},
+					},
+					IsError: true,
+				}, nil, nil
+			}
+		}
+
 		// 获取进程信息（可选）
 		var processInfo *ProcessInfo
 		var ok bool
@@ -183,7 +476,7 @@ func RegisterTools(server *mcp.Server) {
 			if !ok {
 				return &mcp.CallToolResult{
 					Content: []mcp.Content{
-						&mcp.TextContent{Text: fmt.Sprintf("进程不存在: %s", args.ProcessName)},
+						&mcp.TextContent{Text: fmt.Sprintf("进程不存在: %s%s", args.ProcessName, exitRecordHint(args.ProcessName))},
 					},
 					IsError: true,
 				}, nil, nil
@@ -300,6 +593,21 @@ func RegisterTools(server *mcp.Server) {
 			req.Header.Set("Content-Type", "application/json")
 		}
 
+		// 注入关联请求ID（如果用户已在 headers 中指定则直接使用）
+		var requestID string
+		correlationHeader := args.CorrelationHeader
+		if correlationHeader == "" {
+			correlationHeader = defaultCorrelationHeader
+		}
+		if processInfo != nil && !strings.EqualFold(correlationHeader, "none") {
+			requestID = req.Header.Get(correlationHeader)
+			if requestID == "" {
+				requestID = uuid.New().String()
+				req.Header.Set(correlationHeader, requestID)
+			}
+			logger.Debug("注入关联请求头 %s: %s", correlationHeader, requestID)
+		}
+
 		// 使用带超时的 HTTP 客户端
 		httpClient := &http.Client{
 			Timeout: 60 * time.Second,
@@ -314,6 +622,12 @@ func RegisterTools(server *mcp.Server) {
 		var statusCode int
 		if err != nil {
 			responseBody = fmt.Sprintf("请求失败: %v", err)
+			// 关联进程在运行但请求超时，多半是服务卡住了
+			if processInfo != nil && errors.Is(err, context.DeadlineExceeded) {
+				if exited, _, _ := processInfo.ExitStatus(); !exited {
+					responseBody += "\n提示：请求超时而进程仍在运行，服务可能已卡死，使用 dump_stacks 查看 goroutine 堆栈"
+				}
+			}
 			statusCode = 0
 			logger.Error("HTTP请求失败: %v", err)
 		} else {
@@ -324,11 +638,38 @@ func RegisterTools(server *mcp.Server) {
 			logger.Info("HTTP请求成功: 状态码=%d, 耗时=%v", statusCode, duration)
 		}
 
-		// 获取请求期间的日志（使用时间窗口，无需等待）
+		// 按策略继续等待异步日志（基于日志写入通知，而不是固定 sleep）
+		settleReason := ""
+		var settleDuration time.Duration
+		if processInfo != nil && settlePolicy.Enabled() {
+			settleStart := time.Now()
+			settleReason = processInfo.WaitForLogSettle(requestStartTime, settlePolicy)
+			settleDuration = time.Since(settleStart)
+			logger.Info("日志等待结束: 原因=%s, 耗时=%v", settleReason, settleDuration)
+		}
+
+		// 结束合并窗口中的日志并等待写入环形缓冲区，确保请求末尾的日志（如未结束的堆栈）能被查询到
+		if processInfo != nil && !processInfo.FlushLogs(logFlushTimeout) {
+			logger.Debug("等待日志刷新超时")
+		}
+
+		// 获取请求期间的日志：优先按请求ID精确匹配，没有匹配时回退到时间窗口
 		var requestLogs string
+		logMatch := ""
 		if processInfo != nil {
-			// 使用时间窗口获取日志（包含请求前1秒到请求后500ms的日志）
-			requestLogs = processInfo.GetRequestLog(requestStartTime)
+			var entries []LogEntry
+			if requestID != "" {
+				entries = processInfo.GetRequestLogByID(requestID, requestStartTime)
+				logMatch = "request_id"
+			}
+			if len(entries) == 0 {
+				// 使用时间窗口获取日志（包含请求前1秒到请求后500ms的日志）
+				entries = processInfo.GetRequestLog(requestStartTime)
+				logMatch = "time_window"
+			}
+			logger.Debug("请求日志关联方式: %s, 共 %d 条", logMatch, len(entries))
+
+			requestLogs = renderLogs(entries, logView)
 			if requestLogs == "" {
 				requestLogs = "(请求期间无进程日志输出)"
 				logger.Debug("请求期间未捕获到进程日志")
@@ -337,6 +678,12 @@ func RegisterTools(server *mcp.Server) {
 			requestLogs = "(未关联进程)"
 		}
 
+		// 关联的进程意外退出时，附带退出报告（如请求失败 connection refused 的原因）
+		var exitNotice string
+		if processInfo != nil {
+			exitNotice = processManager.TakeExitNotice(processInfo.Name)
+		}
+
 		// 每次请求都写入日志文件（包含请求期间的进程日志）
 		logFilePath := writeResponseToFile(method, fullURL, statusCode, duration, responseBody, requestLogs)
 
@@ -353,6 +700,16 @@ func RegisterTools(server *mcp.Server) {
 		if logFilePath != "" {
 			structuredResp["log_file"] = logFilePath
 		}
+		if requestID != "" {
+			structuredResp["request_id"] = requestID
+		}
+		if logMatch != "" {
+			structuredResp["log_match"] = logMatch
+		}
+		if settleReason != "" {
+			structuredResp["settle_reason"] = settleReason
+			structuredResp["settle_ms"] = settleDuration.Milliseconds()
+		}
 
 		if totalContentLen > maxInlineLen && logFilePath != "" {
 			// 内容过长，只返回文件路径和摘要
@@ -376,7 +733,11 @@ func RegisterTools(server *mcp.Server) {
 			responseText = fmt.Sprintf("请求完成\n方法: %s\nURL: %s\n状态码: %d\n耗时: %v\n\n响应:\n%s",
 				method, fullURL, statusCode, duration, responseBody)
 			if processInfo != nil && requestLogs != "" {
-				responseText += fmt.Sprintf("\n\n请求期间进程日志:\n%s", requestLogs)
+				if logMatch == "request_id" {
+					responseText += fmt.Sprintf("\n\n请求期间进程日志（按 %s=%s 匹配）:\n%s", correlationHeader, requestID, requestLogs)
+				} else {
+					responseText += fmt.Sprintf("\n\n请求期间进程日志:\n%s", requestLogs)
+				}
 			}
 			// if logFilePath != "" {
 			// 	responseText += fmt.Sprintf("\n\n(完整日志已保存: %s)", logFilePath)
@@ -388,6 +749,32 @@ func RegisterTools(server *mcp.Server) {
 			}
 		}
 
+		if settleReason != "" {
+			responseText += fmt.Sprintf("\n\n(请求返回后继续收集日志 %v，结束原因: %s)", settleDuration.Round(time.Millisecond), settleReason)
+		}
+		// 关联的进程存活探测失败时提示（如请求超时的原因是进程已卡死）
+		if processInfo != nil && exitNotice == "" {
+			if monitor := processInfo.liveness.Load(); monitor != nil {
+				liveness := monitor.Status()
+				structuredResp["liveness"] = liveness.structured()
+				if liveness.Failures > 0 {
+					notice := fmt.Sprintf("⚠️ 进程 %s 存活探测: %s\n", processInfo.Name, liveness.Summary())
+					if liveness.LastAction != "" {
+						notice += fmt.Sprintf("不健康处理: %s\n", liveness.LastAction)
+					} else if liveness.Unhealthy {
+						notice += "提示：进程可能已卡死，使用 dump_stacks 查看 goroutine 堆栈\n"
+					}
+					responseText = notice + "\n" + responseText
+				}
+			}
+		}
+		if exitNotice != "" {
+			responseText = exitNotice + "\n" + responseText
+			if record, ok := processManager.GetExitRecord(processInfo.Name); ok {
+				structuredResp["process_exit"] = record.structured()
+			}
+		}
+
 		return &mcp.CallToolResult{
 			StructuredContent: structuredResp,
 			Content: []mcp.Content{
@@ -398,90 +785,764 @@ func RegisterTools(server *mcp.Server) {
 
 	// 注册 kill_process 工具：杀掉进程
 	type killProcessArgs struct {
-		Name string `json:"name,omitempty" jsonschema:"进程名称（可选），如果提供则优先匹配本mcp启动的进程"`
-		Port int    `json:"port,omitempty" jsonschema:"端口号（可选），杀掉占用该端口的进程"`
+		Name         string `json:"name,omitempty" jsonschema:"进程名称（可选），如果提供则优先匹配本mcp启动的进程"`
+		Port         int    `json:"port,omitempty" jsonschema:"端口号（可选），杀掉占用该端口的进程"`
+		GraceSeconds int    `json:"grace_seconds,omitempty" jsonschema:"按名称终止时，先发送 SIGTERM（Windows 为 CTRL_BREAK）让进程执行退出逻辑，等待该秒数后仍未退出再强制终止，默认5秒"`
+		Force        bool   `json:"force,omitempty" jsonschema:"跳过优雅退出，直接强制终止进程树"`
 	}
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "kill_process",
-		Description: "杀掉进程。可以通过进程名称（优先匹配本mcp启动的进程）或端口号来指定要杀掉的进程。如果同时提供name和port，优先使用name。",
+		Description: "杀掉进程。可以通过进程名称（优先匹配本mcp启动的进程）或端口号来指定要杀掉的进程。如果同时提供name和port，优先使用name。按名称终止时先发送 SIGTERM（Windows 为 CTRL_BREAK）让服务执行退出逻辑，宽限期内未退出再强制终止整个进程树，并返回进程在哪个阶段结束。",
 	}, func(ctx context.Context, _ *mcp.CallToolRequest, args killProcessArgs) (*mcp.CallToolResult, any, error) {
 		// 获取工具执行权限，确保工具串行执行
 		acquireToolSemaphore()
 		defer releaseToolSemaphore()
 
-		logger.Info("=== 开始终止进程 ===")
+		logger.Info("=== 开始终止进程 ===")
+
+		// 检查参数
+		if args.Name == "" && args.Port == 0 {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: "参数错误：必须提供 name 或 port 参数中的至少一个"},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+
+		// 优先使用 name 参数
+		if args.Name != "" {
+			logger.Info("尝试通过进程名称终止: %s", args.Name)
+
+			// 首先尝试从本 mcp 启动的进程中查找
+			if info, ok := processManager.GetProcess(args.Name); ok {
+				logger.Info("找到本 mcp 启动的进程: %s (PID: %d)", args.Name, info.Cmd.Process.Pid)
+
+				// 主动终止的进程不再因源码变化或重启策略自动重启
+				processManager.StopWatch(args.Name)
+				processManager.StopSupervisor(args.Name)
+
+				stopResult, err := processManager.KillProcess(args.Name, stopGrace(args.GraceSeconds, args.Force))
+				if err != nil {
+					logger.Error("终止进程失败: %v", err)
+					return &mcp.CallToolResult{
+						Content: []mcp.Content{
+							&mcp.TextContent{Text: fmt.Sprintf("终止进程失败: %v", err)},
+						},
+						IsError: true,
+					}, nil, nil
+				}
+
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{
+						&mcp.TextContent{Text: fmt.Sprintf("成功终止进程\n进程名称: %s\nPID: %d\n结果: %s", args.Name, info.Cmd.Process.Pid, stopResult.Describe())},
+					},
+				}, nil, nil
+			}
+
+			// 如果本 mcp 没有启动过这个进程，提示用户
+			logger.Info("本 mcp 未启动过名为 '%s' 的进程", args.Name)
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("未找到进程 '%s'%s\n提示：本 mcp 未启动过此进程。如果该进程正在运行，请使用 port 参数来终止它。", args.Name, exitRecordHint(args.Name))},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+
+		// 使用 port 参数
+		if args.Port > 0 {
+			logger.Info("尝试通过端口号终止进程: %d", args.Port)
+
+			if err := killProcessByPort(args.Port); err != nil {
+				logger.Error("终止端口 %d 的进程失败: %v", args.Port, err)
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{
+						&mcp.TextContent{Text: fmt.Sprintf("终止端口 %d 的进程失败: %v", args.Port, err)},
+					},
+					IsError: true,
+				}, nil, nil
+			}
+
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("成功终止占用端口 %d 的进程", args.Port)},
+				},
+			}, nil, nil
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "未知错误"},
+			},
+			IsError: true,
+		}, nil, nil
+	})
+
+	// 注册 list_processes 工具：列出本 mcp 管理的所有进程
+	type listProcessesArgs struct{}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "list_processes",
+		Description: "列出本mcp启动并管理的所有进程，包括进程名称、PID、命令、工作目录、健康检查地址、运行时长以及是否已退出。上下文被截断后，调用 start_process 之前应先用此工具确认服务是否已在运行。",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, args listProcessesArgs) (*mcp.CallToolResult, any, error) {
+		// 获取工具执行权限，确保工具串行执行
+		acquireToolSemaphore()
+		defer releaseToolSemaphore()
+
+		logger.Info("=== 列出进程 ===")
+
+		processes := processManager.ListProcesses()
+		if len(processes) == 0 {
+			return &mcp.CallToolResult{
+				StructuredContent: map[string]any{
+					"count":     0,
+					"processes": []map[string]any{},
+				},
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: "当前没有本 mcp 管理的进程。"},
+				},
+			}, nil, nil
+		}
+
+		var resultBuilder strings.Builder
+		resultBuilder.WriteString(fmt.Sprintf("本 mcp 管理的进程共 %d 个\n\n", len(processes)))
+
+		items := make([]map[string]any, 0, len(processes))
+		for i, info := range processes {
+			item, status, uptime := describeProcess(info)
+			// 退出记录包含退出码和信号，列表中已展示，不再在后续工具调用中重复提示
+			if _, ok := item["exit_code"]; ok {
+				if record, ok := processManager.GetExitRecord(info.Name); ok {
+					record.reported.Store(true)
+				}
+			}
+			items = append(items, item)
+
+			resultBuilder.WriteString(fmt.Sprintf("### %d. %s\n", i+1, info.Name))
+			resultBuilder.WriteString(fmt.Sprintf("- 状态: %s\n", status))
+			resultBuilder.WriteString(fmt.Sprintf("- PID: %d\n", item["pid"]))
+			resultBuilder.WriteString(fmt.Sprintf("- 命令: %s\n", strings.Join(info.Cmd.Args, " ")))
+			resultBuilder.WriteString(fmt.Sprintf("- 工作目录: %s\n", info.Cmd.Dir))
+			if readiness, ok := item["readiness"]; ok {
+				resultBuilder.WriteString(fmt.Sprintf("- 就绪探测: %s\n", readiness))
+			} else {
+				resultBuilder.WriteString(fmt.Sprintf("- 健康检查: %s (端口: %d)\n", info.HealthCheckURL, info.HealthCheckPort))
+			}
+			if monitor := info.liveness.Load(); monitor != nil && item["exited"] == false {
+				liveness := monitor.Status()
+				resultBuilder.WriteString(fmt.Sprintf("- 存活探测: %s，每 %v 一次: %s\n", liveness.Probe, liveness.Interval, liveness.Summary()))
+				if liveness.LastAction != "" {
+					resultBuilder.WriteString(fmt.Sprintf("- 不健康处理: %s\n", liveness.LastAction))
+				}
+			}
+			if item["watching"] == true {
+				resultBuilder.WriteString("- 源码监听: 已开启（变化后自动重启）\n")
+			}
+			if status, ok := processManager.GetSupervisorStatus(info.Name); ok {
+				resultBuilder.WriteString(fmt.Sprintf("- 重启策略: %s，已自动重启 %d 次\n", status.Policy.String(), len(status.History)))
+				if status.CrashLoop != "" {
+					resultBuilder.WriteString("- ⚠️ " + status.CrashLoop + "\n")
+				}
+			}
+			resultBuilder.WriteString(fmt.Sprintf("- 启动时间: %s\n", info.StartTime.Format(time.RFC3339)))
+			resultBuilder.WriteString(fmt.Sprintf("- 运行时长: %v\n\n", uptime))
+		}
+
+		logger.Info("共列出 %d 个进程", len(processes))
+		return &mcp.CallToolResult{
+			StructuredContent: map[string]any{
+				"count":     len(processes),
+				"processes": items,
+			},
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: resultBuilder.String()},
+			},
+		}, nil, nil
+	})
+
+	// 注册 get_logs 工具：按条件查询进程日志
+	type getLogsArgs struct {
+		Name      string `json:"name" jsonschema:"进程名称"`
+		Tail      int    `json:"tail,omitempty" jsonschema:"只返回最后N行，未指定时间范围时默认200"`
+		Since     string `json:"since,omitempty" jsonschema:"起始时间，支持RFC3339、'2006-01-02 15:04:05'、'15:04:05' 或相对时长（如 '5m' 表示5分钟前）"`
+		Until     string `json:"until,omitempty" jsonschema:"结束时间，格式同 since"`
+		Grep      string `json:"grep,omitempty" jsonschema:"正则表达式，只返回匹配的行"`
+		Exclude   string `json:"exclude,omitempty" jsonschema:"正则表达式，排除匹配的行"`
+		Stream    string `json:"stream,omitempty" jsonschema:"日志来源：all、stdout、stderr，默认全部"`
+		MinLevel  string `json:"min_level,omitempty" jsonschema:"只返回不低于该级别的日志：trace/debug/info/warn/error/fatal（JSON日志取level字段，纯文本按行首的级别标记或 level=xxx 识别，无法识别级别的行默认不返回，见 include_unleveled）"`
+		Unleveled bool   `json:"include_unleveled,omitempty" jsonschema:"设置 min_level 时仍返回无法识别级别的行（如没有级别标记的 fmt.Println 输出）"`
+		Format    string `json:"format,omitempty" jsonschema:"显示格式：raw（默认，原始行）或 compact（JSON日志显示为 级别 消息 key=value 的紧凑形式）"`
+		Stacks    bool   `json:"stack_traces,omitempty" jsonschema:"只返回堆栈（Go panic、Java 异常、Python Traceback 等），可配合 since 查看某时间之后出现的所有堆栈"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_logs",
+		Description: "查询本mcp启动的进程日志（最近1000条，堆栈等多行输出合并为一条），支持按最后N行、时间范围、正则包含/排除、stdout/stderr 过滤，返回带捕获时间的日志行。用于查看后台任务、定时任务、启动异常等不在 request_with_logs 窗口内的日志。",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, args getLogsArgs) (*mcp.CallToolResult, any, error) {
+		// 获取工具执行权限，确保工具串行执行
+		acquireToolSemaphore()
+		defer releaseToolSemaphore()
+
+		logger.Info("=== 查询进程日志 ===")
+		logger.Info("进程: %s, tail: %d, since: %s, until: %s, grep: %s, exclude: %s, stream: %s",
+			args.Name, args.Tail, args.Since, args.Until, args.Grep, args.Exclude, args.Stream)
+
+		processInfo, ok := processManager.GetProcess(args.Name)
+		if !ok {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("进程不存在: %s%s\n提示：使用 list_processes 查看本 mcp 管理的进程", args.Name, exitRecordHint(args.Name))},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+
+		// 构建查询条件
+		query := LogQuery{Tail: args.Tail}
+		var err error
+		if query.Since, err = parseLogTime(args.Since); err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("参数错误：since %v", err)},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+		if query.Until, err = parseLogTime(args.Until); err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("参数错误：until %v", err)},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+		if args.Grep != "" {
+			if query.Include, err = regexp.Compile(args.Grep); err != nil {
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{
+						&mcp.TextContent{Text: fmt.Sprintf("参数错误：grep 正则无效: %v", err)},
+					},
+					IsError: true,
+				}, nil, nil
+			}
+		}
+		if args.Exclude != "" {
+			if query.Exclude, err = regexp.Compile(args.Exclude); err != nil {
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{
+						&mcp.TextContent{Text: fmt.Sprintf("参数错误：exclude 正则无效: %v", err)},
+					},
+					IsError: true,
+				}, nil, nil
+			}
+		}
+		view, err := parseLogView(args.Stream, args.MinLevel, args.Unleveled, args.Format)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("参数错误：%v", err)},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+		query.Stream = view.Stream
+		query.MinLevel = view.MinLevel
+		query.Unleveled = view.Unleveled
+		query.StackTraceOnly = args.Stacks
+
+		// 未指定范围时默认只返回最后200行，避免一次返回过多内容
+		if query.Tail <= 0 && query.Since.IsZero() && query.Until.IsZero() {
+			query.Tail = 200
+		}
+
+		entries, earliest := processInfo.QueryLogs(query)
+		exitNotice := processManager.TakeExitNotice(args.Name)
+
+		structuredEntries := make([]map[string]any, 0, len(entries))
+		for _, entry := range entries {
+			item := map[string]any{
+				"seq":    entry.Seq,
+				"time":   entry.Time.Format(time.RFC3339Nano),
+				"stream": entry.Stream,
+				"line":   entry.Line,
+			}
+			if name, ok := levelNames[entry.Level]; ok {
+				item["level"] = name
+			}
+			if entry.StackTrace {
+				item["stack_trace"] = true
+			}
+			if sl := entry.Structured; sl != nil {
+				item["msg"] = sl.Msg
+				if sl.Caller != "" {
+					item["caller"] = sl.Caller
+				}
+				if sl.Error != "" {
+					item["error"] = sl.Error
+				}
+				if len(sl.Fields) > 0 {
+					item["fields"] = sl.Fields
+				}
+			}
+			structuredEntries = append(structuredEntries, item)
+		}
+		structuredResp := map[string]any{
+			"name":    args.Name,
+			"count":   len(entries),
+			"entries": structuredEntries,
+		}
+		if !earliest.IsZero() {
+			structuredResp["earliest_available"] = earliest.Format(time.RFC3339Nano)
+		}
+
+		var resultBuilder strings.Builder
+		if exitNotice != "" {
+			resultBuilder.WriteString(exitNotice + "\n")
+		}
+		resultBuilder.WriteString(fmt.Sprintf("进程 %s 共匹配 %d 行日志", args.Name, len(entries)))
+		if !earliest.IsZero() {
+			resultBuilder.WriteString(fmt.Sprintf("（缓冲区最早日志时间: %s）", earliest.Format("2006-01-02 15:04:05.000")))
+		}
+		resultBuilder.WriteString("\n\n")
+		if len(entries) == 0 {
+			resultBuilder.WriteString("(无匹配日志)")
+		} else {
+			resultBuilder.WriteString(formatLogEntries(entries, view.Compact))
+		}
+
+		logger.Info("查询到 %d 行日志", len(entries))
+		return &mcp.CallToolResult{
+			StructuredContent: structuredResp,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: resultBuilder.String()},
+			},
+		}, nil, nil
+	})
+
+	// 注册 get_exit_report 工具：查询进程退出记录
+	type getExitReportArgs struct {
+		Name string `json:"name,omitempty" jsonschema:"进程名称（可选），不提供则返回所有进程的退出记录"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_exit_report",
+		Description: "查询本mcp启动的进程的退出记录，包括退出码、信号、退出时间、运行时长和退出前的最后日志。进程被清理后记录仍然保留。请求返回 connection refused 或进程状态异常时，用此工具查看进程为什么退出。",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, args getExitReportArgs) (*mcp.CallToolResult, any, error) {
+		// 获取工具执行权限，确保工具串行执行
+		acquireToolSemaphore()
+		defer releaseToolSemaphore()
+
+		logger.Info("=== 查询退出记录: %s ===", args.Name)
+
+		var records []*ExitRecord
+		if args.Name != "" {
+			record, ok := processManager.GetExitRecord(args.Name)
+			if !ok {
+				status := "本 mcp 未启动过此进程"
+				if _, running := processManager.GetProcess(args.Name); running {
+					status = "进程仍在运行"
+				}
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{
+						&mcp.TextContent{Text: fmt.Sprintf("进程 %s 没有退出记录（%s）", args.Name, status)},
+					},
+				}, nil, nil
+			}
+			records = []*ExitRecord{record}
+		} else {
+			records = processManager.ListExitRecords()
+		}
+
+		if len(records) == 0 {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: "暂无进程退出记录。"},
+				},
+			}, nil, nil
+		}
+
+		var resultBuilder strings.Builder
+		items := make([]map[string]any, 0, len(records))
+		for i, record := range records {
+			if i > 0 {
+				resultBuilder.WriteString("\n---\n\n")
+			}
+			resultBuilder.WriteString(record.Report())
+			items = append(items, record.structured())
+			record.reported.Store(true)
+		}
+
+		return &mcp.CallToolResult{
+			StructuredContent: map[string]any{
+				"count":   len(records),
+				"records": items,
+			},
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: resultBuilder.String()},
+			},
+		}, nil, nil
+	})
+
+	// 注册 get_watch_status 工具：查询源码监听状态和自动重启结果
+	type getWatchStatusArgs struct {
+		Name string `json:"name" jsonschema:"进程名称"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_watch_status",
+		Description: "查询 start_process 开启 watch 后的源码监听状态，以及源码变化触发的最近几次自动重启结果（健康检查是否通过，失败时包含编译错误等启动日志）。修改代码后用此工具确认服务是否已按新代码重启成功。",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, args getWatchStatusArgs) (*mcp.CallToolResult, any, error) {
+		// 获取工具执行权限，确保工具串行执行
+		acquireToolSemaphore()
+		defer releaseToolSemaphore()
+
+		logger.Info("=== 查询源码监听状态: %s ===", args.Name)
+
+		status, ok := processManager.GetWatchStatus(args.Name)
+		if !ok {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("进程 %s 没有开启源码监听\n提示：使用 start_process 的 watch 参数开启，kill_process 后监听会停止", args.Name)},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+
+		return &mcp.CallToolResult{
+			StructuredContent: status.structured(args.Name),
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: status.Report(args.Name)},
+			},
+		}, nil, nil
+	})
+
+	// 注册 get_restart_history 工具：查询重启策略的执行状态和自动重启记录
+	type getRestartHistoryArgs struct {
+		Name string `json:"name" jsonschema:"进程名称"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_restart_history",
+		Description: "查询 start_process 设置 restart_policy 后的重启策略状态，以及进程意外退出后的自动重启记录（退出原因、第几次重启、时间、重启是否成功）。连续重启超过上限时会报告崩溃循环并停止自动重启，此时应查看日志修复问题后用 restart_process 重启。",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, args getRestartHistoryArgs) (*mcp.CallToolResult, any, error) {
+		// 获取工具执行权限，确保工具串行执行
+		acquireToolSemaphore()
+		defer releaseToolSemaphore()
+
+		logger.Info("=== 查询重启记录: %s ===", args.Name)
+
+		status, ok := processManager.GetSupervisorStatus(args.Name)
+		if !ok {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("进程 %s 没有设置重启策略\n提示：使用 start_process 的 restart_policy 参数设置，kill_process 后重启策略会停止", args.Name)},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+
+		return &mcp.CallToolResult{
+			StructuredContent: status.structured(args.Name),
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: status.Report(args.Name)},
+			},
+		}, nil, nil
+	})
+
+	// 注册 dump_stacks 工具：获取进程的 goroutine 堆栈并按堆栈去重
+	type dumpStacksArgs struct {
+		Name        string `json:"name" jsonschema:"进程名称（本mcp启动的进程）"`
+		Method      string `json:"method,omitempty" jsonschema:"获取方式：auto（默认，服务导入了 net/http/pprof 时请求 /debug/pprof/goroutine?debug=2，否则发送 SIGQUIT）、pprof（只用 pprof，不影响进程）、signal（发送 SIGQUIT，Go 进程把堆栈打印到 stderr 后退出，Windows 不支持）"`
+		NoRestart   bool   `json:"no_restart,omitempty" jsonschema:"收到 SIGQUIT 的进程打印堆栈后会退出，默认取得堆栈后按启动参数重新启动；为 true 时不重启，保留退出现场"`
+		WaitSeconds int    `json:"wait_seconds,omitempty" jsonschema:"发送 SIGQUIT 后等待堆栈输出的秒数，默认5"`
+		MaxGroups   int    `json:"max_groups,omitempty" jsonschema:"最多显示多少组堆栈（按 goroutine 数量从多到少），默认20，完整堆栈见保存的文件"`
+		MaxFrames   int    `json:"max_frames,omitempty" jsonschema:"每组最多显示多少帧，默认15"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "dump_stacks",
+		Description: "获取本mcp启动的 Go 进程的全部 goroutine 堆栈，按堆栈去重分组（数量、状态、最长等待时间、goroutine ID），完整堆栈保存到 logs 目录。请求卡住、超时或存活探测失败时用它查看服务卡在哪里（死锁、等待锁、channel 阻塞等）。",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, args dumpStacksArgs) (*mcp.CallToolResult, any, error) {
+		// 获取工具执行权限，确保工具串行执行
+		acquireToolSemaphore()
+		defer releaseToolSemaphore()
+
+		logger.Info("=== 获取 goroutine 堆栈 ===")
+		logger.Info("进程名称: %s", args.Name)
+
+		method := strings.ToLower(args.Method)
+		switch method {
+		case "":
+			method = StackMethodAuto
+		case StackMethodAuto, StackMethodPprof, StackMethodSignal:
+		default:
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("参数错误：method 只能是 auto、pprof 或 signal，收到 '%s'", args.Method)},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+		maxGroups := args.MaxGroups
+		if maxGroups <= 0 {
+			maxGroups = 20
+		}
+		maxFrames := args.MaxFrames
+		if maxFrames <= 0 {
+			maxFrames = 15
+		}
+
+		info, ok := processManager.GetProcess(args.Name)
+		if !ok {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("进程不存在: %s%s", args.Name, exitRecordHint(args.Name))},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+		if exited, _, _ := info.ExitStatus(); exited {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("进程 %s 已退出，无法获取堆栈%s\n提示：退出前输出的堆栈（如 panic）可用 get_logs 的 stack_traces=true 查看", args.Name, exitRecordHint(args.Name))},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+
+		dump, err := captureStacks(info, method, time.Duration(args.WaitSeconds)*time.Second)
+		if err != nil {
+			logger.Error("获取进程 %s 的 goroutine 堆栈失败: %v", args.Name, err)
+			text := fmt.Sprintf("获取 goroutine 堆栈失败: %v", err)
+			if exited, _, _ := info.ExitStatus(); exited {
+				text += exitRecordHint(args.Name)
+			}
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: text},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+		logger.Info("进程 %s 共 %d 个 goroutine，%d 组", args.Name, len(dump.Goroutines), len(dump.Groups))
+
+		text := dump.Report(args.Name, maxGroups, maxFrames)
+		structured := dump.structured(args.Name, maxGroups)
+		if dump.Exited {
+			// 退出是本工具造成的，结果中已说明，不再在后续工具调用中提示
+			processManager.TakeExitNotice(args.Name)
+			if args.NoRestart {
+				text += "\n进程打印堆栈后已退出（未重启），使用 restart_process 按原参数重新启动\n"
+			} else {
+				healthy, output := relaunch(args.Name)
+				structured["restarted"] = healthy
+				if healthy {
+					text += "\n进程打印堆栈后已退出，已按启动参数重新启动\n"
+				} else {
+					text += fmt.Sprintf("\n进程打印堆栈后已退出，重新启动失败:\n%s\n", output)
+				}
+			}
+		}
+
+		return &mcp.CallToolResult{
+			StructuredContent: structured,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: text},
+			},
+		}, nil, nil
+	})
+
+	// 注册 profile_process 工具：采集 CPU / 内存 profile 并按函数汇总
+	type profileProcessArgs struct {
+		Name       string `json:"name" jsonschema:"进程名称（本mcp启动的进程，需导入 net/http/pprof 并设置了 health_check_url）"`
+		Type       string `json:"type,omitempty" jsonschema:"profile 类型：cpu（默认，采样 seconds 秒内的 CPU 耗时）、heap（当前内存分配，采集前先触发一次 GC）"`
+		Seconds    int    `json:"seconds,omitempty" jsonschema:"CPU 采样秒数，默认10，最多120"`
+		Top        int    `json:"top,omitempty" jsonschema:"显示前多少个函数，默认20"`
+		Sort       string `json:"sort,omitempty" jsonschema:"排序方式：flat（默认，函数自身的耗时/分配）、cum（包含其调用的函数）"`
+		SampleType string `json:"sample_type,omitempty" jsonschema:"汇总的样本类型，默认使用 profile 的默认类型（cpu 为 cpu，heap 为 inuse_space），heap 还可选 inuse_objects、alloc_space、alloc_objects"`
+		LoadPath   string `json:"load_path,omitempty" jsonschema:"CPU 采样期间持续请求的路径（如 /api/search?q=x），用于分析某个接口的性能；工具串行执行，采样期间无法另外调用 request_with_logs"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "profile_process",
+		Description: "采集本mcp启动的 Go 进程的 CPU 或内存 profile（请求健康检查地址所在主机的 /debug/pprof/profile 或 /debug/pprof/heap），原始 profile 保存到 logs 目录，返回按函数汇总的 flat/cum 前 N 项。排查性能下降、CPU 占用高或内存增长时使用，不要凭日志猜测。",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, args profileProcessArgs) (*mcp.CallToolResult, any, error) {
+		// 获取工具执行权限，确保工具串行执行
+		acquireToolSemaphore()
+		defer releaseToolSemaphore()
+
+		logger.Info("=== 采集 profile ===")
+		logger.Info("进程名称: %s", args.Name)
+
+		kind := strings.ToLower(args.Type)
+		if kind == "" {
+			kind = ProfileCPU
+		}
+		sortBy := strings.ToLower(args.Sort)
+		if sortBy == "" {
+			sortBy = "flat"
+		}
+		var argErr string
+		switch {
+		case kind != ProfileCPU && kind != ProfileHeap:
+			argErr = fmt.Sprintf("type 只能是 cpu 或 heap，收到 '%s'", args.Type)
+		case sortBy != "flat" && sortBy != "cum":
+			argErr = fmt.Sprintf("sort 只能是 flat 或 cum，收到 '%s'", args.Sort)
+		case args.Seconds < 0 || args.Seconds > maxProfileSeconds:
+			argErr = fmt.Sprintf("seconds 必须在 1 到 %d 之间", maxProfileSeconds)
+		case args.LoadPath != "" && kind != ProfileCPU:
+			argErr = "load_path 只用于 cpu profile"
+		}
+		if argErr != "" {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: "参数错误：" + argErr},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+		seconds := args.Seconds
+		if seconds == 0 {
+			seconds = defaultProfileSeconds
+		}
+		top := args.Top
+		if top <= 0 {
+			top = defaultProfileTop
+		}
+
+		info, ok := processManager.GetProcess(args.Name)
+		if !ok {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("进程不存在: %s%s", args.Name, exitRecordHint(args.Name))},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+		if exited, _, _ := info.ExitStatus(); exited {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("进程 %s 已退出，无法采集 profile%s", args.Name, exitRecordHint(args.Name))},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+
+		profile, err := captureProfile(info, kind, seconds, args.SampleType, args.LoadPath)
+		if err != nil {
+			logger.Error("采集进程 %s 的 %s profile 失败: %v", args.Name, kind, err)
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("采集 %s profile 失败: %v", kind, err)},
+				},
+				IsError: true,
+			}, nil, nil
+		}
+		sortProfileEntries(profile.Entries, sortBy)
+		logger.Info("进程 %s 的 %s profile: %s 共 %d 个函数", args.Name, kind, profile.SampleType, len(profile.Entries))
+
+		structured := profile.structured(args.Name, top)
+		structured["sort"] = sortBy
+		return &mcp.CallToolResult{
+			StructuredContent: structured,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: profile.Report(args.Name, top, sortBy)},
+			},
+		}, nil, nil
+	})
+
+	// 注册 list_services 工具：列出项目配置中定义的服务
+	type listServicesArgs struct {
+		WorkDir string `json:"work_dir,omitempty" jsonschema:"配置文件所在的工作目录，默认为当前目录"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "list_services",
+		Description: "列出工作目录下项目配置文件 .gomcp.json 中定义的服务（命令、工作目录、环境变量名、健康检查、超时）以及是否正在运行，配置有误时返回具体错误。列出的服务可以只传 name 调用 start_process 启动。",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, args listServicesArgs) (*mcp.CallToolResult, any, error) {
+		// 获取工具执行权限，确保工具串行执行
+		acquireToolSemaphore()
+		defer releaseToolSemaphore()
+
+		dir := configDir(args.WorkDir)
+		logger.Info("=== 列出项目配置中的服务: %s ===", dir)
 
-		// 检查参数
-		if args.Name == "" && args.Port == 0 {
+		config, err := loadProjectConfig(dir)
+		if err != nil {
 			return &mcp.CallToolResult{
 				Content: []mcp.Content{
-					&mcp.TextContent{Text: "参数错误：必须提供 name 或 port 参数中的至少一个"},
+					&mcp.TextContent{Text: err.Error()},
 				},
 				IsError: true,
 			}, nil, nil
 		}
-
-		// 优先使用 name 参数
-		if args.Name != "" {
-			logger.Info("尝试通过进程名称终止: %s", args.Name)
-
-			// 首先尝试从本 mcp 启动的进程中查找
-			if info, ok := processManager.GetProcess(args.Name); ok {
-				logger.Info("找到本 mcp 启动的进程: %s (PID: %d)", args.Name, info.Cmd.Process.Pid)
-
-				if err := processManager.KillProcess(args.Name); err != nil {
-					logger.Error("终止进程失败: %v", err)
-					return &mcp.CallToolResult{
-						Content: []mcp.Content{
-							&mcp.TextContent{Text: fmt.Sprintf("终止进程失败: %v", err)},
-						},
-						IsError: true,
-					}, nil, nil
-				}
-
-				return &mcp.CallToolResult{
-					Content: []mcp.Content{
-						&mcp.TextContent{Text: fmt.Sprintf("成功终止进程\n进程名称: %s\nPID: %d", args.Name, info.Cmd.Process.Pid)},
-					},
-				}, nil, nil
-			}
-
-			// 如果本 mcp 没有启动过这个进程，提示用户
-			logger.Info("本 mcp 未启动过名为 '%s' 的进程", args.Name)
+		if config == nil {
 			return &mcp.CallToolResult{
+				StructuredContent: map[string]any{
+					"count":    0,
+					"services": []map[string]any{},
+				},
 				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("未找到进程 '%s'\n提示：本 mcp 未启动过此进程。如果该进程正在运行，请使用 port 参数来终止它。", args.Name)},
+					&mcp.TextContent{Text: fmt.Sprintf("目录 %s 下没有项目配置文件 %s", dir, projectConfigFile)},
 				},
-				IsError: true,
 			}, nil, nil
 		}
 
-		// 使用 port 参数
-		if args.Port > 0 {
-			logger.Info("尝试通过端口号终止进程: %d", args.Port)
-
-			if err := killProcessByPort(args.Port); err != nil {
-				logger.Error("终止端口 %d 的进程失败: %v", args.Port, err)
-				return &mcp.CallToolResult{
-					Content: []mcp.Content{
-						&mcp.TextContent{Text: fmt.Sprintf("终止端口 %d 的进程失败: %v", args.Port, err)},
-					},
-					IsError: true,
-				}, nil, nil
+		var resultBuilder strings.Builder
+		resultBuilder.WriteString(fmt.Sprintf("项目配置 %s 中的服务共 %d 个\n\n", config.Path, len(config.Services)))
+		items := make([]map[string]any, 0, len(config.Services))
+		for i, name := range config.ServiceNames() {
+			service, _ := config.Service(name)
+			envKeys := make([]string, 0, len(service.Env))
+			for key := range service.Env {
+				envKeys = append(envKeys, key)
+			}
+			sort.Strings(envKeys)
+			running := false
+			if info, ok := processManager.GetProcess(name); ok {
+				exited, _, _ := info.ExitStatus()
+				running = !exited
 			}
 
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("成功终止占用端口 %d 的进程", args.Port)},
-				},
-			}, nil, nil
+			items = append(items, map[string]any{
+				"name":             name,
+				"description":      service.Description,
+				"command":          service.Command,
+				"args":             service.Args,
+				"work_dir":         service.WorkDir,
+				"env_keys":         envKeys,
+				"env_files":        service.EnvFiles,
+				"health_check_url": service.HealthCheckURL,
+				"timeout_seconds":  service.TimeoutSeconds,
+				"running":          running,
+			})
+
+			resultBuilder.WriteString(fmt.Sprintf("### %d. %s\n", i+1, name))
+			if service.Description != "" {
+				resultBuilder.WriteString(fmt.Sprintf("- 说明: %s\n", service.Description))
+			}
+			resultBuilder.WriteString(fmt.Sprintf("- 命令: %s\n", service.CommandLine()))
+			resultBuilder.WriteString(fmt.Sprintf("- 工作目录: %s\n", service.WorkDir))
+			if len(envKeys) > 0 {
+				resultBuilder.WriteString(fmt.Sprintf("- 环境变量: %s\n", strings.Join(envKeys, ", ")))
+			}
+			if len(service.EnvFiles) > 0 {
+				resultBuilder.WriteString(fmt.Sprintf("- 环境变量文件: %s\n", strings.Join(service.EnvFiles, ", ")))
+			}
+			if probe, err := newReadinessProbe(LaunchSpec{HealthCheckURL: service.HealthCheckURL, Readiness: service.Readiness}); err == nil {
+				resultBuilder.WriteString(fmt.Sprintf("- 就绪探测: %s\n", probe.Describe()))
+			}
+			if service.TimeoutSeconds > 0 {
+				resultBuilder.WriteString(fmt.Sprintf("- 启动超时: %d秒\n", service.TimeoutSeconds))
+			}
+			if running {
+				resultBuilder.WriteString("- 状态: 运行中\n")
+			}
+			resultBuilder.WriteString("\n")
 		}
 
 		return &mcp.CallToolResult{
+			StructuredContent: map[string]any{
+				"config":   config.Path,
+				"count":    len(items),
+				"services": items,
+			},
 			Content: []mcp.Content{
-				&mcp.TextContent{Text: "未知错误"},
+				&mcp.TextContent{Text: resultBuilder.String()},
 			},
-			IsError: true,
 		}, nil, nil
 	})
 
@@ -1075,6 +2136,459 @@ func RegisterTools(server *mcp.Server) {
 	})
 }
 
+// launchProcess 按启动参数启动进程并等待健康检查通过，返回包含启动日志的结果（start_process 和 restart_process 共用）
+// 已有同名进程时先终止它，grace 为终止旧进程时的优雅退出宽限期
+func launchProcess(ctx context.Context, spec LaunchSpec, logView LogView, grace time.Duration) *mcp.CallToolResult {
+	logger := GetLogger()
+
+	// 先校验探测参数，参数错误时不影响正在运行的旧进程
+	probe, err := newReadinessProbe(spec)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("参数错误：%v", err)},
+			},
+			IsError: true,
+		}
+	}
+	var livenessProbe ReadinessProbe
+	if spec.Liveness != nil {
+		if livenessProbe, err = newLivenessProbe(spec); err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("参数错误：%v", err)},
+				},
+				IsError: true,
+			}
+		}
+	}
+
+	// 先执行构建，失败时返回编译错误，不启动新进程，旧进程继续运行
+	// Windows 上运行中的可执行文件无法被覆盖，只能在旧进程停止后构建
+	var buildNote string
+	var failed *mcp.CallToolResult
+	if spec.Build != nil && buildWhileRunning {
+		var note string
+		if oldProcess, exists := processManager.GetProcess(spec.Name); exists {
+			note = fmt.Sprintf("旧进程 (PID: %d) 未受影响，仍在运行\n", oldProcess.Cmd.Process.Pid)
+		}
+		if buildNote, failed = launchBuild(spec, note); failed != nil {
+			return failed
+		}
+	}
+
+	// 如果之前有同名进程在运行，先清理它
+	var oldProcessNote string
+	if oldProcess, exists := processManager.GetProcess(spec.Name); exists {
+		logger.Info("发现同名进程 %s (PID: %d) 仍在运行，先清理...", spec.Name, oldProcess.Cmd.Process.Pid)
+		stopResult, err := processManager.KillProcess(spec.Name, grace)
+		if err != nil {
+			logger.Error("清理旧进程失败: %v", err)
+		} else {
+			oldProcessNote = fmt.Sprintf("旧进程 (PID: %d): %s\n", oldProcess.Cmd.Process.Pid, stopResult.Describe())
+		}
+		// 等待一下让端口释放
+		time.Sleep(1 * time.Second)
+	}
+
+	// 检查端口是否被其他进程占用（非本MCP启动的进程），如果是则尝试清理
+	// 注意：只有在端口确实被占用时才会执行清理
+	if err := KillProcessByHealthCheckURL(spec.HealthCheckURL); err != nil {
+		// 端口未被占用或清理失败都不算严重错误
+		logger.Debug("端口检查: %v", err)
+	}
+
+	// 旧进程停止后才构建时，构建失败的结果需要说明旧进程没有恢复
+	if spec.Build != nil && !buildWhileRunning {
+		note := oldProcessNote
+		if note != "" {
+			note += "注意：运行中的可执行文件无法被覆盖，构建前已停止旧进程，构建失败后旧进程不会恢复\n"
+		}
+		if buildNote, failed = launchBuild(spec, note); failed != nil {
+			return failed
+		}
+	}
+
+	processInfo, err := processManager.StartProcess(spec)
+	if err != nil {
+		logger.Error("启动进程失败: %v", err)
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("启动进程失败: %v", err)},
+			},
+			IsError: true,
+		}
+	}
+
+	// 等待就绪（同时监控进程退出）
+	logger.Info("就绪探测: %s", probe.Describe())
+	healthCheckErr := waitForReady(ctx, probe, processInfo, spec.Timeout, spec.Readiness.interval())
+
+	// 按 log_stream/min_level/log_format 参数渲染启动日志，未指定时返回完整的原始日志
+	startupLogs := func() string {
+		if logView == (LogView{}) {
+			return processInfo.LogBuffer.String()
+		}
+		entries, _ := processInfo.QueryLogs(LogQuery{})
+		return renderLogs(entries, logView)
+	}
+
+	if healthCheckErr != nil {
+		// 未就绪的进程没有需要保存的状态，直接强制终止，避免每次启动失败都等待宽限期
+		processManager.KillProcess(spec.Name, 0)
+		// 启动失败的结果中已包含日志，退出记录不再在后续工具调用中重复提示
+		processManager.TakeExitNotice(spec.Name)
+		logger.Error("进程 %s 启动失败: %v", spec.Name, healthCheckErr)
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("进程启动失败\nPID: %d\n就绪探测: %s\n错误: %v\n\n已收集日志:\n%s",
+					processInfo.Cmd.Process.Pid,
+					probe.Describe(),
+					healthCheckErr,
+					startupLogs())},
+			},
+			IsError: true,
+		}
+	}
+
+	logs := startupLogs()
+	processInfo.healthy.Store(true)
+	logger.Info("进程 %s 启动成功", spec.Name)
+	var livenessNote string
+	if livenessProbe != nil {
+		processManager.StartLiveness(processInfo, livenessProbe)
+		livenessNote = fmt.Sprintf("存活探测: %s，每 %v 一次，连续失败 %d 次判定为不健康（处理: %s）\n",
+			livenessProbe.Describe(), spec.Liveness.interval(), spec.Liveness.threshold(), spec.Liveness.action())
+	}
+	processEvents.Emit(ProcessEvent{
+		Type:    EventHealthy,
+		Process: spec.Name,
+		Message: fmt.Sprintf("进程 %s 健康检查通过，耗时 %v", spec.Name, time.Since(processInfo.StartTime).Round(time.Millisecond)),
+		Level:   "info",
+		Data: map[string]any{
+			"pid":              processInfo.Cmd.Process.Pid,
+			"health_check_url": spec.HealthCheckURL,
+			"readiness":        probe.Describe(),
+		},
+	})
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("进程已成功启动\n%s%sPID: %d\n启动时间: %s\n工作目录: %s\n就绪探测: %s\n%s%s\n启动日志:\n%s",
+				oldProcessNote,
+				buildNote,
+				processInfo.Cmd.Process.Pid,
+				processInfo.StartTime.Format(time.RFC3339),
+				processInfo.Cmd.Dir,
+				probe.Describe(),
+				livenessNote,
+				envReport(spec, processInfo.CustomEnv, processInfo.EnvSources, processInfo.Cmd.Env),
+				logs)},
+		},
+	}
+}
+
+// launchArgs start_process 和 start_stack 共用的启动参数，由 launchSpec 统一校验并转换为 LaunchSpec
+type launchArgs struct {
+	Command           string            `json:"command,omitempty" jsonschema:"要执行的命令（可执行文件名，参数放在 args 中），start_process 使用 .gomcp.json 中的服务时可不填"`
+	Args              []string          `json:"args,omitempty" jsonschema:"命令参数列表"`
+	WorkDir           string            `json:"work_dir,omitempty" jsonschema:"工作目录，默认为命令文件所在目录"`
+	Env               map[string]string `json:"env,omitempty" jsonschema:"环境变量，键值对形式，覆盖 env_files 中的同名变量"`
+	EnvFiles          []string          `json:"env_files,omitempty" jsonschema:"dotenv 文件列表（如 ['.env', '.env.local']），相对路径基于工作目录，按顺序加载后面的覆盖前面的，再应用 env；支持 # 注释、引号、export 前缀和 ${VAR} 展开，每次启动和重启时重新读取；启动结果中只列出文件中变量的名称，不显示值"`
+	InheritEnv        string            `json:"inherit_env,omitempty" jsonschema:"继承本mcp环境变量的方式：full（默认，全部继承）、allow（只继承 inherit_env_allow 中的变量）、none（不继承，只使用 env_files 和 env；注意通常仍需要 PATH、HOME，Windows 上需要 SYSTEMROOT）"`
+	InheritEnvAllow   []string          `json:"inherit_env_allow,omitempty" jsonschema:"allow 模式下继承的变量名，支持 * 通配，如 ['PATH', 'HOME', 'GO*']"`
+	UnsetEnv          []string          `json:"unset_env,omitempty" jsonschema:"不传给进程的变量名，支持 * 通配，如 ['GOFLAGS', '*_PROXY']（env 和 env_files 中设置的变量不受影响）"`
+	HealthCheckURL    string            `json:"health_check_url,omitempty" jsonschema:"健康检查接口URL，默认请求该接口，返回 2xx 才算启动成功（只需检查端口能否连接时设置 readiness.type=tcp），使用 .gomcp.json 中的服务或设置了 readiness 时可不填"`
+	Readiness         *ReadinessSpec    `json:"readiness,omitempty" jsonschema:"就绪探测方式，用于 gRPC 服务、worker、命令行程序等非 HTTP 进程，不填则按 health_check_url 检查"`
+	Liveness          *LivenessSpec     `json:"liveness,omitempty" jsonschema:"存活探测：启动成功后在后台按间隔持续探测（默认每10秒请求 health_check_url），连续失败达到阈值时标记为不健康并推送 unhealthy 事件，状态显示在 list_processes 和 request_with_logs 结果中，可选保存 goroutine 堆栈或自动重启"`
+	TimeoutSeconds    int               `json:"timeout_seconds,omitempty" jsonschema:"等待启动超时时间（秒），默认60秒"`
+	HealthCheckMethod string            `json:"health_check_method,omitempty" jsonschema:"健康检查请求方法，默认GET"`
+	JSONLogs          string            `json:"json_logs,omitempty" jsonschema:"结构化日志解析：auto（默认，自动识别以{开头的JSON行）、json（行内任意位置的JSON都解析，适合带前缀的日志）、off（不解析）"`
+	WatchPattern      string            `json:"watch_pattern,omitempty" jsonschema:"监听日志的正则表达式，进程输出匹配的日志时通过 MCP 日志通知推送 log_match 事件（需客户端设置日志级别）"`
+	Watch             bool              `json:"watch,omitempty" jsonschema:"监听工作目录的源码变化，变化后自动重启进程（结果用 get_watch_status 查看），kill_process 时停止监听"`
+	WatchInclude      []string          `json:"watch_include,omitempty" jsonschema:"监听的文件 glob 模式，支持 **，不含 / 的模式匹配任意目录下的文件名，默认 ['**/*.go', 'go.mod', 'go.sum']"`
+	WatchExclude      []string          `json:"watch_exclude,omitempty" jsonschema:"额外忽略的文件或目录 glob 模式（.git、.knowledge、logs、mems、node_modules 等始终忽略）"`
+	WatchDebounceMs   int               `json:"watch_debounce_ms,omitempty" jsonschema:"最后一次文件变化后等待多少毫秒再重启，合并连续写入，默认500"`
+	BuildCommand      string            `json:"build_command,omitempty" jsonschema:"启动前执行的构建命令（可执行文件名，如 'go'），构建失败时返回解析出的编译错误（文件、行、列、信息），不会启动新进程，同名旧进程继续运行（Windows 上运行中的可执行文件无法覆盖，会先停止旧进程再构建）"`
+	BuildArgs         []string          `json:"build_args,omitempty" jsonschema:"构建命令参数，如 ['build', '-o', 'bin/app', '.']，此时 command 设为 './bin/app' 直接运行构建产物"`
+	BuildTimeout      int               `json:"build_timeout_seconds,omitempty" jsonschema:"构建超时时间（秒），默认300秒"`
+	RestartPolicy     string            `json:"restart_policy,omitempty" jsonschema:"健康检查通过后进程意外退出时的重启策略：never（默认）、on-failure（退出码非0或被信号终止时重启）、always（任何意外退出都重启），kill_process 时停止，重启记录用 get_restart_history 查看"`
+	MaxRestarts       int               `json:"max_restarts,omitempty" jsonschema:"连续重启次数上限（运行超过30秒后退出会重新计数），超过视为崩溃循环并停止自动重启，默认5"`
+	RestartBackoffMs  int               `json:"restart_backoff_ms,omitempty" jsonschema:"首次重启前等待的毫秒数，之后每次连续重启翻倍，最长30秒，默认1000"`
+}
+
+// launchSpec 校验启动参数并创建 LaunchSpec，两个工具按同样的规则处理每个参数
+func (a launchArgs) launchSpec(name string) (LaunchSpec, error) {
+	if a.Command == "" {
+		return LaunchSpec{}, fmt.Errorf("必须提供 command")
+	}
+	if strings.Contains(a.Command, " ") {
+		return LaunchSpec{}, fmt.Errorf("command '%s' 包含空格，请将可执行文件名放在 command 中，参数放在 args 中", a.Command)
+	}
+	timeout := time.Duration(a.TimeoutSeconds) * time.Second
+	if timeout == 0 {
+		timeout = 60 * time.Second
+	}
+	logFormat, err := parseLogFormat(a.JSONLogs)
+	if err != nil {
+		return LaunchSpec{}, err
+	}
+	var build *BuildSpec
+	if a.BuildCommand != "" {
+		if strings.Contains(a.BuildCommand, " ") {
+			return LaunchSpec{}, fmt.Errorf("build_command '%s' 包含空格，请将可执行文件名放在 build_command 中，参数放在 build_args 中（如 build_command: \"go\", build_args: [\"build\", \"-o\", \"bin/app\", \".\"]）", a.BuildCommand)
+		}
+		build = &BuildSpec{
+			Command: a.BuildCommand,
+			Args:    a.BuildArgs,
+			Timeout: time.Duration(a.BuildTimeout) * time.Second,
+		}
+	}
+	var watchConfig *WatchConfig
+	if a.Watch {
+		if watchConfig, err = newWatchConfig(a.WatchInclude, a.WatchExclude, a.WatchDebounceMs); err != nil {
+			return LaunchSpec{}, err
+		}
+	}
+	inheritEnv, err := parseInheritEnv(a.InheritEnv, a.InheritEnvAllow)
+	if err != nil {
+		return LaunchSpec{}, err
+	}
+	restartPolicy, err := newRestartPolicy(a.RestartPolicy, a.MaxRestarts, a.RestartBackoffMs)
+	if err != nil {
+		return LaunchSpec{}, err
+	}
+	var watchPattern *regexp.Regexp
+	if a.WatchPattern != "" {
+		if watchPattern, err = regexp.Compile(a.WatchPattern); err != nil {
+			return LaunchSpec{}, fmt.Errorf("watch_pattern 不是合法的正则表达式: %v", err)
+		}
+	}
+
+	spec := LaunchSpec{
+		Name:              name,
+		Command:           a.Command,
+		Args:              a.Args,
+		Env:               a.Env,
+		EnvFiles:          a.EnvFiles,
+		InheritEnv:        inheritEnv,
+		InheritAllow:      a.InheritEnvAllow,
+		UnsetEnv:          a.UnsetEnv,
+		WorkDir:           a.WorkDir,
+		HealthCheckURL:    a.HealthCheckURL,
+		HealthCheckMethod: a.HealthCheckMethod,
+		LogFormat:         logFormat,
+		WatchPattern:      watchPattern,
+		Timeout:           timeout,
+		Watch:             watchConfig,
+		Build:             build,
+		Restart:           restartPolicy,
+		Readiness:         a.Readiness,
+		Liveness:          a.Liveness,
+	}
+	if _, err := newReadinessProbe(spec); err != nil {
+		return LaunchSpec{}, err
+	}
+	if spec.Liveness != nil {
+		if _, err := newLivenessProbe(spec); err != nil {
+			return LaunchSpec{}, err
+		}
+	}
+	return spec, nil
+}
+
+// superviseLaunch 按启动参数开始或停止重启策略和源码监听，并在工具结果中说明
+func superviseLaunch(spec LaunchSpec, result *mcp.CallToolResult) {
+	if spec.Restart != nil {
+		startSupervisor(spec, result)
+	} else {
+		processManager.StopSupervisor(spec.Name)
+	}
+
+	// 启动失败也开始监听：修复编译错误等问题后会自动重启
+	if spec.Watch != nil {
+		startSourceWatch(spec, result)
+	} else {
+		processManager.StopWatch(spec.Name)
+	}
+}
+
+// launchBuild 执行启动前的构建，成功时返回结果中的构建说明
+// 失败时保留启动参数并返回编译错误，note 为结果开头对旧进程状态的说明
+func launchBuild(spec LaunchSpec, note string) (string, *mcp.CallToolResult) {
+	build := runBuild(spec)
+	if !build.Success() {
+		// 保留启动参数，修复编译错误后可以直接 restart_process（或由源码监听自动重启）
+		processManager.saveLaunchSpec(spec)
+		return "", &mcp.CallToolResult{
+			StructuredContent: build.structured(),
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: note + build.Report()},
+			},
+			IsError: true,
+		}
+	}
+	return fmt.Sprintf("构建: %s（耗时 %v）\n", build.Command, build.Duration.Round(time.Millisecond)), nil
+}
+
+// startSourceWatch 开始监听进程工作目录的源码变化，并在工具结果中说明
+func startSourceWatch(spec LaunchSpec, result *mcp.CallToolResult) {
+	dir := resolveWorkDir(spec)
+	processManager.StartWatch(spec.Name, dir, spec.Watch, watchRestarter(spec.Name))
+	if text, ok := result.Content[0].(*mcp.TextContent); ok {
+		text.Text += fmt.Sprintf("\n源码监听: 已开启（目录: %s，文件: %s），变化后自动重启，使用 get_watch_status 查看重启结果\n",
+			dir, strings.Join(spec.Watch.Include, ", "))
+	}
+}
+
+// watchRestarter 源码变化后按最新的启动参数重启进程，与工具调用一样串行执行
+func watchRestarter(name string) func(changed []string, stop <-chan struct{}) (WatchOutcome, bool) {
+	return func(changed []string, stop <-chan struct{}) (WatchOutcome, bool) {
+		acquireToolSemaphore()
+		defer releaseToolSemaphore()
+
+		// 等待执行权限期间监听可能已被 kill_process 停止
+		select {
+		case <-stop:
+			return WatchOutcome{}, false
+		default:
+		}
+
+		healthy, output := relaunch(name)
+		GetLogger().Info("源码变化后重启进程 %s: 健康=%v", name, healthy)
+		return WatchOutcome{Healthy: healthy, Output: output}, true
+	}
+}
+
+// startSupervisor 按启动参数中的重启策略开始监督进程，并在工具结果中说明
+func startSupervisor(spec LaunchSpec, result *mcp.CallToolResult) {
+	processManager.StartSupervisor(spec.Name, spec.Restart, supervisorRestarter(spec.Name))
+	if text, ok := result.Content[0].(*mcp.TextContent); ok {
+		text.Text += fmt.Sprintf("\n重启策略: %s，意外退出后自动重启，使用 get_restart_history 查看重启记录\n", spec.Restart)
+	}
+}
+
+// supervisorRestarter 进程意外退出后按最新的启动参数重启进程，与工具调用一样串行执行
+func supervisorRestarter(name string) func(stop <-chan struct{}) (bool, string, bool) {
+	return func(stop <-chan struct{}) (bool, string, bool) {
+		acquireToolSemaphore()
+		defer releaseToolSemaphore()
+
+		// 等待执行权限期间监督可能已被 kill_process 停止
+		select {
+		case <-stop:
+			return false, "", false
+		default:
+		}
+		// 等待期间进程已被 start_process / restart_process / 源码监听重新启动，无需再重启
+		if info, ok := processManager.GetProcess(name); ok {
+			if exited, _, _ := info.ExitStatus(); !exited {
+				GetLogger().Info("进程 %s 已在运行，跳过自动重启", name)
+				return false, "", false
+			}
+		}
+
+		healthy, output := relaunch(name)
+		return healthy, output, true
+	}
+}
+
+// relaunch 按最新的启动参数重启进程（源码监听和重启策略共用），返回健康检查是否通过和启动结果
+func relaunch(name string) (bool, string) {
+	spec, ok := processManager.GetLaunchSpec(name)
+	if !ok {
+		return false, fmt.Sprintf("未找到进程 '%s' 的启动参数", name)
+	}
+	result := launchProcess(context.Background(), spec, LogView{}, DefaultStopGrace)
+	var output string
+	if text, ok := result.Content[0].(*mcp.TextContent); ok {
+		output = text.Text
+	}
+	return !result.IsError, output
+}
+
+// describeProcess 汇总进程的状态信息，返回结构化信息、状态描述和运行时长
+func describeProcess(info *ProcessInfo) (map[string]any, string, time.Duration) {
+	pid := 0
+	if info.Cmd.Process != nil {
+		pid = info.Cmd.Process.Pid
+	}
+	exited, exitErr, exitTime := info.ExitStatus()
+
+	// 已退出的进程按退出时间计算运行时长
+	endTime := time.Now()
+	if exited {
+		endTime = exitTime
+	}
+	uptime := endTime.Sub(info.StartTime).Round(time.Second)
+
+	item := map[string]any{
+		"name":              info.Name,
+		"pid":               pid,
+		"command":           info.Cmd.Args[0],
+		"args":              info.Cmd.Args[1:],
+		"work_dir":          info.Cmd.Dir,
+		"health_check_url":  info.HealthCheckURL,
+		"health_check_port": info.HealthCheckPort,
+		"start_time":        info.StartTime.Format(time.RFC3339),
+		"uptime_seconds":    int64(uptime.Seconds()),
+		"exited":            exited,
+	}
+
+	status := "运行中"
+	if exited {
+		item["exit_time"] = exitTime.Format(time.RFC3339)
+		if exitErr != nil {
+			item["exit_error"] = exitErr.Error()
+			status = fmt.Sprintf("已退出（%v）", exitErr)
+		} else {
+			status = "已退出（正常）"
+		}
+		// 退出记录包含退出码和信号
+		if record, ok := processManager.GetExitRecord(info.Name); ok && record.PID == pid {
+			item["exit_code"] = record.ExitCode
+			if record.Signal != "" {
+				item["signal"] = record.Signal
+			}
+			status = fmt.Sprintf("已退出（%s）", record.Cause())
+		}
+	}
+	if info.Spec.Readiness != nil {
+		if probe, err := newReadinessProbe(info.Spec); err == nil {
+			item["readiness"] = probe.Describe()
+		}
+	}
+	if monitor := info.liveness.Load(); monitor != nil && !exited {
+		liveness := monitor.Status()
+		item["liveness"] = liveness.structured()
+		if liveness.Unhealthy {
+			status += "，不健康（存活探测失败）"
+		}
+	}
+	if _, watching := processManager.getWatcher(info.Name); watching {
+		item["watching"] = true
+	}
+	if supervision, ok := processManager.GetSupervisorStatus(info.Name); ok {
+		item["restart_policy"] = supervision.Policy.Mode
+		item["restarts"] = len(supervision.History)
+		item["crash_loop"] = supervision.CrashLoop != ""
+		if supervision.Recovering {
+			status += "，正在按重启策略重启"
+		}
+	}
+	return item, status, uptime
+}
+
+// stopGrace 根据工具参数计算终止进程的宽限期，未指定时使用默认值，force 时为 0（直接强制终止）
+func stopGrace(seconds int, force bool) time.Duration {
+	if force {
+		return 0
+	}
+	if seconds <= 0 {
+		return DefaultStopGrace
+	}
+	return time.Duration(seconds) * time.Second
+}
+
 // truncateString 截断字符串到指定长度
 func truncateString(s string, maxLen int) string {
 	if len(s) <= maxLen {
@@ -1083,22 +2597,26 @@ func truncateString(s string, maxLen int) string {
 	return s[:maxLen] + "..."
 }
 
+// logsDir 可执行文件所在目录下的 logs 目录（不存在时创建），用于保存响应和诊断文件
+func logsDir() (string, error) {
+	execPath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("获取可执行文件路径失败: %v", err)
+	}
+	dir := filepath.Join(filepath.Dir(execPath), "logs")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("创建logs目录失败: %v", err)
+	}
+	return dir, nil
+}
+
 // writeResponseToFile 将响应内容写入logs目录下的文件，返回文件路径
 func writeResponseToFile(method, url string, statusCode int, duration time.Duration, responseBody, logs string) string {
 	logger := GetLogger()
 
-	// 获取可执行文件所在目录
-	execPath, err := os.Executable()
+	logsDir, err := logsDir()
 	if err != nil {
-		logger.Error("获取可执行文件路径失败: %v", err)
-		return ""
-	}
-	execDir := filepath.Dir(execPath)
-	logsDir := filepath.Join(execDir, "logs")
-
-	// 确保logs目录存在
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		logger.Error("创建logs目录失败: %v", err)
+		logger.Error("%v", err)
 		return ""
 	}
 
@@ -1178,44 +2696,3 @@ func waitForHTTPReady(ctx context.Context, url, method string, timeout time.Dura
 		}
 	}
 }
-
-// waitForHTTPReadyWithExitCheck 等待 HTTP 服务就绪，同时监控进程退出
-func waitForHTTPReadyWithExitCheck(ctx context.Context, url, method string, timeout time.Duration, exitChan <-chan error) error {
-	ctx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
-
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("等待 HTTP 服务就绪超时")
-		case <-ticker.C:
-			// 创建健康检查请求
-			reqMethod := method
-			if reqMethod == "" {
-				reqMethod = "GET"
-			}
-
-			req, err := http.NewRequestWithContext(ctx, reqMethod, url, nil)
-			if err != nil {
-				continue
-			}
-
-			resp, err := http.DefaultClient.Do(req)
-			if err == nil {
-				resp.Body.Close()
-				if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-					return nil // 服务就绪
-				}
-			}
-		case exitErr := <-exitChan:
-			// 进程退出
-			if exitErr != nil {
-				return fmt.Errorf("进程异常退出: %v", exitErr)
-			}
-			return fmt.Errorf("进程已退出")
-		}
-	}
-}
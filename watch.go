@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 源码监听的默认配置
+var (
+	defaultWatchInclude = []string{"**/*.go", "go.mod", "go.sum"}
+	// 本 mcp 自身写入的目录（知识库、日志、记忆）以及常见的无关目录
+	defaultWatchExclude = []string{".git", ".knowledge", "logs", "mems", "node_modules", ".idea", ".vscode"}
+)
+
+const (
+	defaultWatchDebounce = 500 * time.Millisecond
+	watchPollInterval    = 500 * time.Millisecond
+	watchHistorySize     = 10 // 保留最近的重启结果条数
+	watchChangedFilesMax = 20 // 每次重启记录的变化文件数上限
+)
+
+// WatchConfig 源码监听配置（start_process 的 watch 参数）
+type WatchConfig struct {
+	Include  []string      // 需要监听的文件，glob 模式，支持 **；不含 / 的模式匹配任意目录下的文件名
+	Exclude  []string      // 忽略的文件或目录，规则同 Include，匹配的目录整个跳过
+	Debounce time.Duration // 最后一次变化后静默多久才重启，合并连续的写入
+}
+
+// newWatchConfig 校验参数并补充默认值
+func newWatchConfig(include, exclude []string, debounceMs int) (*WatchConfig, error) {
+	cfg := &WatchConfig{
+		Include:  include,
+		Exclude:  append(append([]string(nil), defaultWatchExclude...), exclude...),
+		Debounce: time.Duration(debounceMs) * time.Millisecond,
+	}
+	if len(cfg.Include) == 0 {
+		cfg.Include = defaultWatchInclude
+	}
+	if cfg.Debounce <= 0 {
+		cfg.Debounce = defaultWatchDebounce
+	}
+	for _, pattern := range append(append([]string(nil), cfg.Include...), cfg.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("无效的 glob 模式 '%s': %v", pattern, err)
+		}
+	}
+	return cfg, nil
+}
+
+// WatchOutcome 一次因源码变化触发的重启结果
+type WatchOutcome struct {
+	Time         time.Time
+	ChangedFiles []string
+	Healthy      bool   // 重启后健康检查是否通过
+	Output       string // 重启结果（失败时包含编译错误等启动日志）
+}
+
+// sourceWatcher 轮询监听工作目录中的源码变化，变化平息后重启进程
+type sourceWatcher struct {
+	name    string
+	dir     string
+	cfg     *WatchConfig
+	restart func(changed []string, stop <-chan struct{}) (WatchOutcome, bool)
+	stop    chan struct{}
+
+	mu       sync.Mutex
+	history  []WatchOutcome // 最近的重启结果，最新的在最后
+	pending  []string       // 已检测到但尚未触发重启的变化
+	lastScan time.Time
+	files    int // 最近一次扫描时监听的文件数
+}
+
+// StartWatch 开始监听进程工作目录的源码变化，已有监听时替换为新配置
+// restart 在变化平息后被调用，负责重启进程并返回结果；stop 关闭表示监听已停止，此时不应再重启（返回 false）
+func (pm *ProcessManager) StartWatch(name, dir string, cfg *WatchConfig, restart func(changed []string, stop <-chan struct{}) (WatchOutcome, bool)) {
+	pm.StopWatch(name)
+
+	w := &sourceWatcher{
+		name:    name,
+		dir:     dir,
+		cfg:     cfg,
+		restart: restart,
+		stop:    make(chan struct{}),
+	}
+	pm.watchers.Store(name, w)
+	go w.run()
+	GetLogger().Info("开始监听进程 %s 的源码变化: %s (include=%v, exclude=%v, debounce=%v)", name, dir, cfg.Include, cfg.Exclude, cfg.Debounce)
+}
+
+// StopWatch 停止监听，没有监听时什么都不做
+func (pm *ProcessManager) StopWatch(name string) {
+	val, ok := pm.watchers.LoadAndDelete(name)
+	if !ok {
+		return
+	}
+	close(val.(*sourceWatcher).stop)
+	GetLogger().Info("停止监听进程 %s 的源码变化", name)
+}
+
+// getWatcher 获取进程的源码监听
+func (pm *ProcessManager) getWatcher(name string) (*sourceWatcher, bool) {
+	val, ok := pm.watchers.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return val.(*sourceWatcher), true
+}
+
+// run 轮询协程：每次扫描与上一次的快照比较，变化在 Debounce 内没有再发生时触发重启
+func (w *sourceWatcher) run() {
+	logger := GetLogger()
+	snapshot := w.scan()
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	var lastChange time.Time
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		next := w.scan()
+		changed := diffSnapshots(snapshot, next)
+		snapshot = next
+
+		w.mu.Lock()
+		if len(changed) > 0 {
+			w.pending = mergeChanged(w.pending, changed)
+			lastChange = time.Now()
+			w.mu.Unlock()
+			continue
+		}
+		if len(w.pending) == 0 || time.Since(lastChange) < w.cfg.Debounce {
+			w.mu.Unlock()
+			continue
+		}
+		pending := w.pending
+		w.pending = nil
+		w.mu.Unlock()
+
+		logger.Info("进程 %s 的源码发生变化，重启进程: %v", w.name, pending)
+		outcome, restarted := w.restart(pending, w.stop)
+		if !restarted {
+			// 等待重启期间监听已停止（如 kill_process）
+			return
+		}
+		outcome.Time = time.Now()
+		outcome.ChangedFiles = pending
+		if len(outcome.ChangedFiles) > watchChangedFilesMax {
+			outcome.ChangedFiles = outcome.ChangedFiles[:watchChangedFilesMax]
+		}
+
+		w.mu.Lock()
+		w.history = append(w.history, outcome)
+		if len(w.history) > watchHistorySize {
+			w.history = w.history[len(w.history)-watchHistorySize:]
+		}
+		w.mu.Unlock()
+
+		// 重启期间的变化（如编译输出）不再触发新的重启
+		snapshot = w.scan()
+	}
+}
+
+// fileStamp 文件的修改时间和大小，用于判断文件是否变化
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// scan 扫描工作目录中所有需要监听的文件
+func (w *sourceWatcher) scan() map[string]fileStamp {
+	files := make(map[string]fileStamp)
+	filepath.WalkDir(w.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// 文件在扫描过程中被删除等情况，跳过即可
+			return nil
+		}
+		rel, relErr := filepath.Rel(w.dir, p)
+		if relErr != nil || rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if matchAnyGlob(w.cfg.Exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !matchAnyGlob(w.cfg.Include, rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files[rel] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+
+	w.mu.Lock()
+	w.lastScan = time.Now()
+	w.files = len(files)
+	w.mu.Unlock()
+	return files
+}
+
+// diffSnapshots 比较两次扫描，返回新增、修改和删除的文件
+func diffSnapshots(before, after map[string]fileStamp) []string {
+	var changed []string
+	for name, stamp := range after {
+		if old, ok := before[name]; !ok || !old.modTime.Equal(stamp.modTime) || old.size != stamp.size {
+			changed = append(changed, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// mergeChanged 合并变化文件列表并去重
+func mergeChanged(list, changed []string) []string {
+	seen := make(map[string]bool, len(list))
+	for _, name := range list {
+		seen[name] = true
+	}
+	for _, name := range changed {
+		if !seen[name] {
+			seen[name] = true
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+// matchAnyGlob 判断相对路径是否匹配任意一个 glob 模式
+func matchAnyGlob(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob glob 匹配：不含 / 的模式匹配文件名（任意目录下），否则按路径段匹配，** 匹配任意层目录
+func matchGlob(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments 逐段匹配路径
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// WatchStatus 源码监听状态（用于 get_watch_status）
+type WatchStatus struct {
+	Dir      string
+	Config   WatchConfig
+	Files    int
+	LastScan time.Time
+	Pending  []string
+	History  []WatchOutcome
+}
+
+// GetWatchStatus 获取进程的源码监听状态
+func (pm *ProcessManager) GetWatchStatus(name string) (WatchStatus, bool) {
+	w, ok := pm.getWatcher(name)
+	if !ok {
+		return WatchStatus{}, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return WatchStatus{
+		Dir:      w.dir,
+		Config:   *w.cfg,
+		Files:    w.files,
+		LastScan: w.lastScan,
+		Pending:  append([]string(nil), w.pending...),
+		History:  append([]WatchOutcome(nil), w.history...),
+	}, true
+}
+
+// Report 监听状态的文字报告，包括最近的重启结果（最新的在前）
+func (s WatchStatus) Report(name string) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("进程 %s 的源码监听\n", name))
+	builder.WriteString(fmt.Sprintf("目录: %s\n", s.Dir))
+	builder.WriteString(fmt.Sprintf("监听: %s（%d 个文件）\n", strings.Join(s.Config.Include, ", "), s.Files))
+	builder.WriteString(fmt.Sprintf("忽略: %s\n", strings.Join(s.Config.Exclude, ", ")))
+	builder.WriteString(fmt.Sprintf("防抖: %v\n", s.Config.Debounce))
+	if len(s.Pending) > 0 {
+		builder.WriteString(fmt.Sprintf("等待重启的变化: %s\n", strings.Join(s.Pending, ", ")))
+	}
+
+	if len(s.History) == 0 {
+		builder.WriteString("\n尚未因源码变化重启过。\n")
+		return builder.String()
+	}
+	builder.WriteString(fmt.Sprintf("\n最近 %d 次重启:\n", len(s.History)))
+	for i := len(s.History) - 1; i >= 0; i-- {
+		outcome := s.History[i]
+		result := "健康检查通过"
+		if !outcome.Healthy {
+			result = "启动失败"
+		}
+		builder.WriteString(fmt.Sprintf("\n### %s %s\n", outcome.Time.Format("15:04:05"), result))
+		builder.WriteString(fmt.Sprintf("变化文件: %s\n", strings.Join(outcome.ChangedFiles, ", ")))
+		// 只有最近一次重启输出完整结果，更早的只保留摘要
+		if i == len(s.History)-1 {
+			builder.WriteString("\n" + outcome.Output + "\n")
+		}
+	}
+	return builder.String()
+}
+
+// structured 监听状态的结构化形式
+func (s WatchStatus) structured(name string) map[string]any {
+	history := make([]map[string]any, 0, len(s.History))
+	for i := len(s.History) - 1; i >= 0; i-- {
+		outcome := s.History[i]
+		history = append(history, map[string]any{
+			"time":          outcome.Time.Format(time.RFC3339),
+			"changed_files": outcome.ChangedFiles,
+			"healthy":       outcome.Healthy,
+			"output":        outcome.Output,
+		})
+	}
+	return map[string]any{
+		"name":        name,
+		"dir":         s.Dir,
+		"include":     s.Config.Include,
+		"exclude":     s.Config.Exclude,
+		"debounce_ms": s.Config.Debounce.Milliseconds(),
+		"files":       s.Files,
+		"last_scan":   s.LastScan.Format(time.RFC3339),
+		"pending":     s.Pending,
+		"restarts":    history,
+	}
+}